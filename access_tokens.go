@@ -0,0 +1,220 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ScopeTasksRead     = "tasks:read"
+	ScopeTasksWrite    = "tasks:write"
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeProjectsAdmin = "projects:admin"
+)
+
+// impliedScopes are the scopes that come with a broader one.
+var impliedScopes = map[string][]string{
+	ScopeTasksRead:     nil,
+	ScopeTasksWrite:    {ScopeTasksRead},
+	ScopeProjectsRead:  nil,
+	ScopeProjectsWrite: {ScopeProjectsRead},
+	ScopeProjectsAdmin: {ScopeProjectsWrite, ScopeProjectsRead},
+}
+
+// accessTokenPrefix tells personal access tokens from JWTs, and makes them
+// easy to find for secret scanners.
+const accessTokenPrefix = "pat_"
+
+const maxAccessTokenNameLength = 100
+
+// authenticateAccessToken checks a personal access token for a route that
+// accepts the given scopes. The status is the one to answer with when the
+// token is refused.
+func authenticateAccessToken(store Store, token string, scopes []string) (*Principal, int, error) {
+	if len(scopes) == 0 {
+		return nil, http.StatusForbidden, errAccessTokenNotAllowed
+	}
+
+	t, err := store.GetAccessTokenByHash(hashToken(token))
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	now := time.Now()
+
+	if t.RevokedAt != nil || (t.ExpiresAt != nil && now.After(*t.ExpiresAt)) {
+		return nil, http.StatusUnauthorized, errors.New("revoked or expired access token")
+	}
+
+	user, err := store.GetUserByID(strconv.FormatInt(t.UserID, 10))
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	// logout-all and password changes end the tokens created before them too
+	if user.TokensRevokedAt != nil && t.CreatedAt.Before(*user.TokensRevokedAt) {
+		return nil, http.StatusUnauthorized, errors.New("access token revoked with the user's sessions")
+	}
+
+	principal := &Principal{
+		UserID: user.ID,
+		Email:  user.Email,
+		Roles:  []string{user.Role},
+		Scopes: t.Scopes,
+	}
+
+	for _, scope := range scopes {
+		if !principal.HasScope(scope) {
+			return nil, http.StatusForbidden, errInsufficientScope
+		}
+	}
+
+	if err := store.TouchAccessToken(t.ID, now); err != nil {
+		log.Printf("failed to record access token use: %v", err)
+	}
+
+	return principal, 0, nil
+}
+
+// handleGetAccessTokens lists the tokens of the caller that are not revoked.
+func (s *UserService) handleGetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		permissionDenied(w)
+		return
+	}
+
+	tokens, err := s.store.ListAccessTokens(userID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing access tokens"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tokens)
+}
+
+// handleCreateAccessToken returns the new token, the only time it is shown.
+// Logging out everywhere and changing or resetting the password revoke it
+// like the sessions of the user.
+func (s *UserService) handleCreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		permissionDenied(w)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *CreateAccessTokenPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if err := validateAccessTokenPayload(payload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while creating the access token"})
+		return
+	}
+	token := accessTokenPrefix + secret
+
+	t := &AccessToken{
+		UserID:    userID,
+		Name:      payload.Name,
+		Prefix:    token[:len(accessTokenPrefix)+4],
+		TokenHash: hashToken(token),
+		Scopes:    payload.Scopes,
+		ExpiresAt: payload.ExpiresAt,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	if err := s.store.CreateAccessToken(t); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while creating the access token"})
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, &CreatedAccessToken{AccessToken: t, Token: token})
+}
+
+func (s *UserService) handleRevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		permissionDenied(w)
+		return
+	}
+
+	id, err := parseIDParam(mux.Vars(r)["id"])
+	if err != nil || id == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidID.Error()})
+		return
+	}
+
+	err = s.store.RevokeAccessToken(userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "access token not found"})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while revoking the access token"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// validateAccessTokenPayload also trims the name and drops duplicate scopes.
+func validateAccessTokenPayload(p *CreateAccessTokenPayload) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errNameRequired
+	}
+
+	if utf8.RuneCountInString(p.Name) > maxAccessTokenNameLength {
+		return errNameTooLong
+	}
+
+	if len(p.Scopes) == 0 {
+		return errScopesRequired
+	}
+
+	seen := map[string]bool{}
+	scopes := []string{}
+	for _, scope := range p.Scopes {
+		if _, ok := impliedScopes[scope]; !ok {
+			return errInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	p.Scopes = scopes
+
+	if p.ExpiresAt != nil && !p.ExpiresAt.After(time.Now()) {
+		return errExpiryInPast
+	}
+
+	return nil
+}
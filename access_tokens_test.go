@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidateAccessTokenPayload(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		payload  *CreateAccessTokenPayload
+		expected error
+	}{
+		{&CreateAccessTokenPayload{Name: " ", Scopes: []string{ScopeTasksRead}}, errNameRequired},
+		{&CreateAccessTokenPayload{Name: "ci"}, errScopesRequired},
+		{&CreateAccessTokenPayload{Name: "ci", Scopes: []string{"tasks:delete"}}, errInvalidScope},
+		{&CreateAccessTokenPayload{Name: "ci", Scopes: []string{ScopeTasksRead}, ExpiresAt: &past}, errExpiryInPast},
+		{&CreateAccessTokenPayload{Name: "ci", Scopes: []string{ScopeTasksRead, ScopeTasksRead}}, nil},
+		{&CreateAccessTokenPayload{Name: strings.Repeat("é", maxAccessTokenNameLength), Scopes: []string{ScopeTasksRead}}, nil},
+		{&CreateAccessTokenPayload{Name: strings.Repeat("é", maxAccessTokenNameLength+1), Scopes: []string{ScopeTasksRead}}, errNameTooLong},
+	}
+
+	for _, tt := range tests {
+		if err := validateAccessTokenPayload(tt.payload); err != tt.expected {
+			t.Errorf("expected %v for %+v, got %v", tt.expected, tt.payload, err)
+		}
+	}
+}
+
+func TestAccessTokenAuth(t *testing.T) {
+	store := newTestStore(t)
+	service := NewUserService(store, NewLogMailer("", io.Discard))
+
+	u := newTestUser(t, store)
+
+	create := func(payload string) *CreatedAccessToken {
+		req, err := http.NewRequest(http.MethodPost, "/users/me/tokens", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		service.handleCreateAccessToken(rr, withUserID(req, u.ID))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var token CreatedAccessToken
+		if err := json.NewDecoder(rr.Body).Decode(&token); err != nil {
+			t.Fatal(err)
+		}
+		return &token
+	}
+
+	call := func(token string, scopes ...string) int {
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+			WriteJSON(w, http.StatusOK, GetUserIDFromContext(r.Context()))
+		}, store, scopes...)(rr, req)
+
+		return rr.Code
+	}
+
+	token := create(`{"name":"ci","scopes":["tasks:write","projects:read"]}`)
+
+	t.Run("should show the token once", func(t *testing.T) {
+		tokens, err := store.ListAccessTokens(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 1 || tokens[0].TokenHash == token.Token || tokens[0].Prefix != token.Token[:8] {
+			t.Errorf("unexpected tokens %v", tokens)
+		}
+
+		b, err := json.Marshal(tokens[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(b, []byte(token.Token)) {
+			t.Error("expected the token not to be listed")
+		}
+	})
+
+	t.Run("should enforce scopes", func(t *testing.T) {
+		tests := []struct {
+			scopes   []string
+			expected int
+		}{
+			{[]string{ScopeTasksWrite}, http.StatusOK},
+			{[]string{ScopeTasksRead, ScopeProjectsRead}, http.StatusOK},
+			{[]string{ScopeProjectsWrite}, http.StatusForbidden},
+			{nil, http.StatusForbidden},
+		}
+
+		for _, tt := range tests {
+			if code := call(token.Token, tt.scopes...); code != tt.expected {
+				t.Errorf("expected status code %d for %v, got %d", tt.expected, tt.scopes, code)
+			}
+		}
+	})
+
+	t.Run("should refuse unknown and expired tokens", func(t *testing.T) {
+		if code := call(accessTokenPrefix+"guess", ScopeTasksRead); code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, code)
+		}
+
+		expired := accessTokenPrefix + "expired"
+		err := store.CreateAccessToken(&AccessToken{UserID: u.ID, Name: "old", Prefix: expired[:8], TokenHash: hashToken(expired), Scopes: []string{ScopeTasksRead}, ExpiresAt: timePtr(time.Now().Add(-time.Minute))})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code := call(expired, ScopeTasksRead); code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+
+	t.Run("should refuse revoked tokens", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, "/users/me/tokens/"+strconv.FormatInt(token.ID, 10), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/users/me/tokens/{id}", service.handleRevokeAccessToken)
+		router.ServeHTTP(rr, withUserID(req, u.ID))
+
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+
+		if code := call(token.Token, ScopeTasksRead); code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+
+	t.Run("should end with the sessions of the user", func(t *testing.T) {
+		other := create(`{"name":"scripts","scopes":["tasks:read"]}`)
+
+		if err := store.RevokeUserTokens(u.ID, time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		if code := call(other.Token, ScopeTasksRead); code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+}
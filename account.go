@@ -0,0 +1,327 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (s *UserService) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.loadMe(w, r)
+	if !ok {
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, user)
+}
+
+// handleUpdateMe applies a JSON Merge Patch to the name of the caller.
+func (s *UserService) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.loadMe(w, r)
+	if !ok {
+		return
+	}
+
+	if !isMergePatch(r) {
+		WriteJSON(w, http.StatusUnsupportedMediaType, ErrorResponse{Error: errUnsupportedPatch.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	current := &UpdateProfilePayload{FirstName: user.FirstName, LastName: user.LastName}
+
+	var payload UpdateProfilePayload
+	if err := applyMergePatch(current, body, &payload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid merge patch: " + err.Error()})
+		return
+	}
+
+	payload.FirstName = strings.TrimSpace(payload.FirstName)
+	payload.LastName = strings.TrimSpace(payload.LastName)
+
+	if payload.FirstName == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errFirstNameRequired.Error()})
+		return
+	}
+
+	if payload.LastName == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errLastNameRequired.Error()})
+		return
+	}
+
+	if err := s.store.UpdateUserProfile(user.ID, payload.FirstName, payload.LastName); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while updating the profile"})
+		return
+	}
+
+	user.FirstName, user.LastName = payload.FirstName, payload.LastName
+	WriteJSON(w, http.StatusOK, user)
+}
+
+func (s *UserService) handleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *ChangeEmailPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	user, ok := s.reauthenticate(w, r, payload.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	email, err := mail.ParseAddress(payload.Email)
+	if err != nil || email.Address != strings.TrimSpace(payload.Email) {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidEmail.Error()})
+		return
+	}
+
+	other, err := s.store.GetUserByEmail(email.Address)
+	if err == nil && other.ID != user.ID {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errEmailTaken.Error()})
+		return
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while updating the email"})
+		return
+	}
+
+	if err := s.store.UpdateUserEmail(user.ID, email.Address); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while updating the email"})
+		return
+	}
+
+	if user.Email != email.Address {
+		user.Email, user.EmailVerifiedAt = email.Address, nil
+
+		if err := s.sendVerificationEmail(user); err != nil {
+			log.Printf("sending a verification email to user %d failed: %v", user.ID, err)
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, user)
+}
+
+// handleChangePassword signs the user out everywhere, personal access tokens
+// included, and returns a new token pair for the current client.
+func (s *UserService) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *ChangePasswordPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	user, ok := s.reauthenticate(w, r, payload.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	if payload.NewPassword == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errPasswordRequired.Error()})
+		return
+	}
+
+	hashedPassword, err := HashPassword(payload.NewPassword)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while changing the password"})
+		return
+	}
+
+	if err := s.store.UpdateUserPassword(user.ID, hashedPassword); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while changing the password"})
+		return
+	}
+
+	if !s.revokeSessions(w, r, user.ID) {
+		return
+	}
+
+	tokens, err := createAndSetAuthCookie(s.store, user.ID, "", w)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while changing the password"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (s *UserService) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *DeleteAccountPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	user, ok := s.reauthenticate(w, r, payload.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	err = s.store.DeleteUser(user.ID)
+	if errors.Is(err, errSoleOwner) {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while deleting the account"})
+		return
+	}
+
+	principal, _ := PrincipalFromContext(r.Context())
+	if err := tokenRevocations.Revoke(s.store, principal.TokenID, principal.ExpiresAt); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while deleting the account"})
+		return
+	}
+
+	clearAuthCookie(w)
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handleListUsers is the user directory, e.g. to pick an assignee. ?q= keeps
+// the users whose name or email contains every word of it.
+func (s *UserService) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var afterID int64
+	if c != nil {
+		afterID = c.ID
+	}
+
+	// fetch one extra user to know whether there is a next page
+	users, err := s.store.ListUsers(r.URL.Query().Get("q"), afterID, limit+1)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing users"})
+		return
+	}
+
+	page := &UserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = encodeCursor(cursor{ID: page.Users[limit-1].ID})
+	}
+
+	WriteJSON(w, http.StatusOK, page)
+}
+
+func (s *UserService) loadMe(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		permissionDenied(w)
+		return nil, false
+	}
+
+	user, err := s.store.GetUserByID(strconv.FormatInt(userID, 10))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the user"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// reauthenticate checks the current password of the caller before their
+// credentials change. Wrong passwords count toward the login lockout.
+func (s *UserService) reauthenticate(w http.ResponseWriter, r *http.Request, password string) (*User, bool) {
+	if password == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errCurrentPasswordRequired.Error()})
+		return nil, false
+	}
+
+	me, ok := s.loadMe(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	user, err := s.store.GetUserByEmail(me.Email)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the user"})
+		return nil, false
+	}
+
+	subjects := loginSubjects(r, user.Email)
+
+	until, err := s.loginLockedUntil(subjects)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while checking the password"})
+		return nil, false
+	}
+	if time.Now().Before(until) {
+		tooManyLogins(w, until)
+		return nil, false
+	}
+
+	if !user.validatePassword(password) {
+		if err := s.recordLoginFailure(subjects, subjects[LockoutKindIP], user.ID); err != nil {
+			log.Printf("recording a failed login failed: %v", err)
+		}
+
+		WriteJSON(w, http.StatusForbidden, ErrorResponse{Error: errWrongPassword.Error()})
+		return nil, false
+	}
+
+	return me, true
+}
+
+// revokeSessions invalidates every token of the user, as logout-all does.
+func (s *UserService) revokeSessions(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	if err := s.store.RevokeUserTokens(userID, time.Now()); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while revoking sessions"})
+		return false
+	}
+
+	// the current token may have been issued in the same second
+	principal, _ := PrincipalFromContext(r.Context())
+	if err := tokenRevocations.Revoke(s.store, principal.TokenID, principal.ExpiresAt); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while revoking sessions"})
+		return false
+	}
+
+	return true
+}
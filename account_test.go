@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestUserJSONHidesPassword(t *testing.T) {
+	b, err := json.Marshal(&User{ID: 1, Email: "ada@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(b), "hash") || strings.Contains(string(b), "password") {
+		t.Errorf("expected no password in %s", b)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	ms := &MockStore{}
+	service := NewUserService(ms, NewLogMailer("", io.Discard))
+
+	change := func(payload string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPut, "/users/me/password", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/users/me/password", service.handleChangePassword)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		return rr
+	}
+
+	t.Run("should require the current password", func(t *testing.T) {
+		rr := change(`{"newPassword":"secret"}`)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should refuse a wrong current password", func(t *testing.T) {
+		rr := change(`{"currentPassword":"guess","newPassword":"secret"}`)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
+
+func TestAccountStore(t *testing.T) {
+	store := newTestStore(t)
+
+	newUser := func(first, last, email string) *User {
+		u, err := store.CreateUser(&CreateUserPayload{Email: email, FirstName: first, LastName: last, Password: "hash"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	ada := newUser("Ada", "Lovelace", "ada@example.com")
+	grace := newUser("Grace", "Hopper", "grace@example.com")
+	newUser("Alan", "Turing", "alan_t@example.com")
+
+	t.Run("should search the directory", func(t *testing.T) {
+		tests := []struct {
+			query    string
+			expected int
+		}{
+			{"", 3},
+			{"ADA", 1},
+			{"a example", 3},
+			{"grace hopper", 1},
+			{"_", 1},
+			{"%", 0},
+		}
+
+		for _, tt := range tests {
+			users, err := store.ListUsers(tt.query, 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != tt.expected {
+				t.Errorf("expected %d users for %q, got %d", tt.expected, tt.query, len(users))
+			}
+		}
+	})
+
+	p, err := store.CreateProject(&CreateProjectPayload{Name: "Engine"}, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AddProjectMember(p.ID, grace.ID, RoleMember); err != nil {
+		t.Fatal(err)
+	}
+
+	task, err := store.CreateTask(&CreateTaskPayload{Name: "Gears", Status: StatusTODO, ProjectID: p.ID, AssignedToID: ada.ID}, ada.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should refuse to delete the only owner", func(t *testing.T) {
+		if err := store.DeleteUser(ada.ID); err != errSoleOwner {
+			t.Errorf("expected %v, got %v", errSoleOwner, err)
+		}
+	})
+
+	t.Run("should hand over projects and tasks", func(t *testing.T) {
+		if err := store.UpdateProjectMemberRole(p.ID, grace.ID, RoleOwner); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.DeleteUser(ada.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		project, err := store.GetProject(strconv.FormatInt(p.ID, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if project.OwnerID != grace.ID || project.CreatedByID != 0 {
+			t.Errorf("unexpected project %+v", project)
+		}
+
+		updated, err := store.GetTask(strconv.FormatInt(task.ID, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.AssignedToID != grace.ID || updated.CreatedByID != 0 {
+			t.Errorf("unexpected task %+v", updated)
+		}
+	})
+}
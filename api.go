@@ -8,22 +8,32 @@ import (
 )
 
 type APIServer struct {
-	addr  string
-	store Store
+	addr     string
+	store    Store
+	searcher Searcher
+	mailer   Mailer
 }
 
-func NewAPIServer(addr string, store Store) *APIServer {
+func NewAPIServer(addr string, store Store, searcher Searcher, mailer Mailer) *APIServer {
 	return &APIServer{
-		addr:  addr,
-		store: store,
+		addr:     addr,
+		store:    store,
+		searcher: searcher,
+		mailer:   mailer,
 	}
 }
 
 func (s *APIServer) Serve() {
+	if Envs.RevocationBackend == "memory" {
+		tokenRevocations.SetBackend(NewMemoryRevocationStore())
+	}
+
 	router := mux.NewRouter()
+	router.HandleFunc("/.well-known/jwks.json", handleJWKS).Methods("GET")
+
 	subrouter := router.PathPrefix("/api/v1").Subrouter()
 
-	usersService := NewUserService(s.store)
+	usersService := NewUserService(s.store, s.mailer)
 	usersService.RegisterRoutes(subrouter)
 
 	projectService := NewProjectService(s.store)
@@ -32,8 +42,25 @@ func (s *APIServer) Serve() {
 	tasksService := NewTasksService(s.store)
 	tasksService.RegisterRoutes(subrouter)
 
+	searchService := NewSearchService(s.store, s.searcher)
+	searchService.RegisterRoutes(subrouter)
+
+	trashService := NewTrashService(s.store)
+	trashService.RegisterRoutes(subrouter)
+
+	lockoutService := NewLockoutService(s.store)
+	lockoutService.RegisterRoutes(subrouter)
+
+	// single sign-on is off unless an identity provider is configured
+	if Envs.OIDCIssuer != "" {
+		oidcService := NewOIDCService(s.store, NewOIDCProviderFromConfig(Envs), usersService)
+		oidcService.RegisterRoutes(subrouter)
+	}
+
+	StartTrashPurge(s.store, Envs.TrashRetention, Envs.TrashPurgeInterval)
+
 	log.Println("Starting the API server at ", s.addr)
 
-	log.Fatal(http.ListenAndServe(s.addr, subrouter))
+	log.Fatal(http.ListenAndServe(s.addr, router))
 
 }
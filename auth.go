@@ -1,20 +1,43 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func WithJWTAuth(handlerFunc http.HandlerFunc, store Store) http.HandlerFunc {
+// WithJWTAuth authenticates the request with a JWT or, on routes that list
+// the scopes they need, a personal access token carrying those scopes.
+func WithJWTAuth(handlerFunc http.HandlerFunc, store Store, scopes ...string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// get the token from the request (Auth header)
 		tokenString := GetTokenFromRequest(r)
+
+		if strings.HasPrefix(tokenString, accessTokenPrefix) {
+			principal, status, err := authenticateAccessToken(store, tokenString, scopes)
+			if err != nil {
+				log.Printf("failed to validate access token: %v", err)
+				if status == http.StatusForbidden {
+					WriteJSON(w, status, ErrorResponse{Error: err.Error()})
+				} else {
+					permissionDenied(w)
+				}
+				return
+			}
+
+			handlerFunc(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+			return
+		}
+
 		token, err := validateJWT(tokenString)
 		if err != nil {
 			log.Printf("failed to validate token: %v", err)
@@ -30,19 +53,124 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store Store) http.HandlerFunc {
 		}
 
 		// get the userID from the token
-		claims := token.Claims.(jwt.MapClaims)
-		userID := claims["userID"].(string)
+		claims := token.Claims.(*TokenClaims)
+		userID := claims.Subject
 
-		_, err = store.GetUserByID(userID)
+		user, err := store.GetUserByID(userID)
 		if err != nil {
 			log.Printf("failed to get user by id: %v", err)
 			permissionDenied(w)
 			return
 		}
 
+		revoked, err := tokenRevocations.IsRevoked(store, claims.Id)
+		if err != nil {
+			log.Printf("failed to check token revocation: %v", err)
+			permissionDenied(w)
+			return
+		}
+
+		// logout-all revokes every token issued before it
+		if revoked || (user.TokensRevokedAt != nil && claims.IssuedAt < user.TokensRevokedAt.Unix()) {
+			log.Println("revoked token")
+			permissionDenied(w)
+			return
+		}
+
+		principal := &Principal{
+			UserID:    user.ID,
+			Email:     user.Email,
+			Roles:     []string{user.Role},
+			Session:   true,
+			TokenID:   claims.Id,
+			ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		}
+
 		// Call the function if the token is valid
-		handlerFunc(w, r)
+		handlerFunc(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+	}
+}
+
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+)
+
+// Principal is the authenticated caller of a request. Session is set for the
+// JWTs of a login, which may do anything the user can, anything else is held
+// to Scopes.
+type Principal struct {
+	UserID    int64
+	Email     string
+	Roles     []string
+	Session   bool
+	Scopes    []string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
 	}
+
+	return false
+}
+
+// requireAdmin answers 403 unless the caller is an administrator.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if p, ok := PrincipalFromContext(r.Context()); ok && p.HasRole(UserRoleAdmin) {
+		return true
+	}
+
+	WriteJSON(w, http.StatusForbidden, ErrorResponse{Error: errAdminRequired.Error()})
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.Session {
+		return true
+	}
+
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+		for _, implied := range impliedScopes[s] {
+			if implied == scope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext returns the authenticated caller, ok is false when the
+// request did not go through WithJWTAuth.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// GetUserIDFromContext returns the id of the authenticated user, or 0 when the
+// request did not go through WithJWTAuth.
+func GetUserIDFromContext(ctx context.Context) int64 {
+	if p, ok := PrincipalFromContext(ctx); ok {
+		return p.UserID
+	}
+
+	return 0
 }
 
 func GetTokenFromRequest(r *http.Request) string {
@@ -50,7 +178,7 @@ func GetTokenFromRequest(r *http.Request) string {
 	tokenQuery := r.URL.Query().Get("token")
 
 	if tokenAuth != "" {
-		return tokenAuth
+		return strings.TrimPrefix(tokenAuth, "Bearer ")
 	}
 
 	if tokenQuery != "" {
@@ -69,13 +197,25 @@ func HashPassword(password string) (string, error) {
 	return string(hash), nil
 }
 
-func CreateJWT(secret []byte, userID int64) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID":    strconv.Itoa(int(userID)),
-		"expiresAt": time.Now().Add(time.Hour * 24 * 120).Unix(),
-	})
+// TokenClaims are the claims of the access tokens issued by the API, the
+// subject is the user id.
+type TokenClaims struct {
+	jwt.StandardClaims
+}
 
-	tokenString, err := token.SignedString(secret)
+func CreateJWT(keys *KeySet, userID int64) (string, error) {
+	now := time.Now()
+	tokenString, err := keys.Sign(&TokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.FormatInt(userID, 10),
+			Issuer:    Envs.JWTIssuer,
+			Audience:  Envs.JWTAudience,
+			Id:        newTokenID(),
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(Envs.AccessTokenTTL).Unix(),
+		},
+	})
 	if err != nil {
 		return "", err
 	}
@@ -83,21 +223,49 @@ func CreateJWT(secret []byte, userID int64) (string, error) {
 	return tokenString, err
 }
 
+// newTokenID returns a random identifier for a token.
+func newTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// validateJWT parses the token and checks its signature and its standard
+// claims. exp, iat and nbf are checked by the jwt package, the others here.
 func validateJWT(tokenString string) (*jwt.Token, error) {
-	//secret := os.Getenv("JWT_SECRET")
-	secret := []byte(Envs.JWTSecret)
+	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, signingKeys.Keyfunc)
+	if err != nil {
+		return nil, err
+	}
 
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
+	claims := token.Claims.(*TokenClaims)
 
-		return []byte(secret), nil
-	})
+	if claims.ExpiresAt == 0 || claims.Subject == "" || claims.Id == "" {
+		return nil, errMissingClaims
+	}
+
+	if !claims.VerifyIssuer(Envs.JWTIssuer, true) {
+		return nil, errInvalidIssuer
+	}
+
+	if !claims.VerifyAudience(Envs.JWTAudience, true) {
+		return nil, errInvalidAudience
+	}
+
+	return token, nil
 }
 
 func permissionDenied(w http.ResponseWriter) {
 	WriteJSON(w, http.StatusUnauthorized, ErrorResponse{
 		Error: fmt.Errorf("permission denied").Error(),
 	})
+}
+
+func forbidden(w http.ResponseWriter) {
+	WriteJSON(w, http.StatusForbidden, ErrorResponse{
+		Error: fmt.Errorf("forbidden").Error(),
+	})
 }
\ No newline at end of file
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const maxCommentLength = 10000
+
+func (s *TasksService) handleGetComments(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var afterID int64
+	if c != nil {
+		afterID = c.ID
+	}
+
+	// fetch one extra comment to know whether there is a next page
+	comments, err := s.store.ListComments(task.ID, afterID, limit+1)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing comments"})
+		return
+	}
+
+	page := &CommentPage{Comments: comments}
+	if len(comments) > limit {
+		page.Comments = comments[:limit]
+		page.NextCursor = encodeCursor(cursor{ID: page.Comments[limit-1].ID})
+	}
+
+	WriteJSON(w, http.StatusOK, page)
+}
+
+func (s *TasksService) handleCreateComment(w http.ResponseWriter, r *http.Request) {
+	task, member, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *CommentPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if err := validateCommentPayload(payload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c, err := s.store.CreateComment(task.ID, member.UserID, payload.Body)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while creating the comment"})
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, c)
+}
+
+func (s *TasksService) handleEditComment(w http.ResponseWriter, r *http.Request) {
+	task, member, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
+		return
+	}
+
+	c, ok := s.loadComment(w, r, task.ID)
+	if !ok {
+		return
+	}
+
+	// only the author may rewrite a comment
+	if c.AuthorID != member.UserID {
+		forbidden(w)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *CommentPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if err := validateCommentPayload(payload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c, err = s.store.UpdateComment(c.ID, payload.Body)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while updating the comment"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, c)
+}
+
+func (s *TasksService) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	task, member, ok := s.loadTask(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	c, ok := s.loadComment(w, r, task.ID)
+	if !ok {
+		return
+	}
+
+	// maintainers may remove any comment of their project
+	if c.AuthorID != member.UserID && !hasRole(member.Role, RoleMaintainer) {
+		forbidden(w)
+		return
+	}
+
+	if err := s.store.DeleteComment(c.ID); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error deleting comment"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *TasksService) loadComment(w http.ResponseWriter, r *http.Request, taskID int64) (*Comment, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["commentId"], 10, 64)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidID.Error()})
+		return nil, false
+	}
+
+	c, err := s.store.GetComment(id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && c.TaskID != taskID) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "comment not found"})
+		return nil, false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the comment"})
+		return nil, false
+	}
+
+	return c, true
+}
+
+func validateCommentPayload(c *CommentPayload) error {
+	c.Body = strings.TrimSpace(c.Body)
+
+	if c.Body == "" {
+		return errCommentBodyRequired
+	}
+
+	if utf8.RuneCountInString(c.Body) > maxCommentLength {
+		return errCommentTooLong
+	}
+
+	return nil
+}
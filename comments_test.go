@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCreateComment(t *testing.T) {
+	ms := &MockStore{}
+	service := NewTasksService(ms)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		b, err := json.Marshal(&CommentPayload{Body: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "/tasks/1/comments", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks/{id}/comments", service.handleCreateComment)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		return rr
+	}
+
+	t.Run("should return error if body is blank", func(t *testing.T) {
+		if rr := post("   "); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return error if body is too long", func(t *testing.T) {
+		if rr := post(strings.Repeat("a", maxCommentLength+1)); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should create a comment", func(t *testing.T) {
+		rr := post("**Looks good**")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var c Comment
+		if err := json.NewDecoder(rr.Body).Decode(&c); err != nil {
+			t.Fatal(err)
+		}
+
+		if c.AuthorID != 1 {
+			t.Errorf("expected author 1, got %d", c.AuthorID)
+		}
+	})
+}
+
+func TestEditComment(t *testing.T) {
+	ms := &MockStore{}
+	service := NewTasksService(ms)
+
+	t.Run("should not edit someone else's comment", func(t *testing.T) {
+		b, err := json.Marshal(&CommentPayload{Body: "edited"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPut, "/tasks/1/comments/1", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks/{id}/comments/{commentId}", service.handleEditComment)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+}
+
+func TestCommentsCascade(t *testing.T) {
+	store := newTestStore(t)
+
+	u, p := newTestProject(t, store)
+
+	task, err := store.CreateTask(&CreateTaskPayload{Name: "Gears", Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := store.CreateComment(task.ID, u.ID, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.PurgeProject(p.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetComment(c.ID); err == nil {
+		t.Error("expected the comment to be deleted with its project")
+	}
+}
@@ -2,28 +2,114 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	Port       string
-	DBUser     string
-	DBPassword string
-	DBAddress  string
-	DBName     string
-	JWTSecret  string
+	Port               string
+	AppEnv             string
+	DBDriver           string
+	SQLitePath         string
+	DBUser             string
+	DBPassword         string
+	DBAddress          string
+	DBName             string
+	JWTSecret          string
+	JWTKeysDir         string
+	JWTSigningKeyID    string
+	JWTIssuer          string
+	JWTAudience        string
+	AccessTokenTTL     time.Duration
+	RefreshTokenTTL    time.Duration
+	RevocationBackend  string
+	RevocationCacheTTL time.Duration
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+	AppURL             string
+	MailDriver         string
+	MailFrom           string
+	MailFile           string
+	MailMaxPerEmail    int
+	MailMaxPerIP       int
+	MailThrottleWindow time.Duration
+	SMTPHost           string
+	SMTPPort           string
+	SMTPUser           string
+	SMTPPassword       string
+	EmailVerifyTTL     time.Duration
+	PasswordResetTTL   time.Duration
+	LoginMaxFailures   int
+	LoginMaxIPFailures int
+	LoginLockout       time.Duration
+	LoginLockoutMax    time.Duration
+	LoginFailureWindow time.Duration
+	TrustProxyHeaders  bool
+	TwoFactorRequired  bool
+	TOTPIssuer         string
+	LoginChallengeTTL  time.Duration
+	OIDCIssuer         string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCRedirectURL    string
+	OIDCScopes         string
 }
 
+// defaultJWTSecret is only good enough for development, see validateConfig.
+const defaultJWTSecret = "randomjwtsecretkey"
+
 var Envs = initConfig()
 
 func initConfig() Config {
 	return Config{
-		Port:       getEnv("PORT", "8080"),
-		DBUser:     getEnv("DB_USER", "root"),
-		DBPassword: getEnv("DB_PASSWORD", "admin"),
-		DBAddress:  fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
-		DBName:     getEnv("DB_NAME", "project_manager"),
-		JWTSecret:  getEnv("JWT_SECRET", "randomjwtsecretkey"),
+		Port:               getEnv("PORT", "8080"),
+		AppEnv:             getEnv("APP_ENV", "production"),
+		DBDriver:           getEnv("DB_DRIVER", "mysql"),
+		SQLitePath:         getEnv("SQLITE_PATH", "project_manager.db"),
+		DBUser:             getEnv("DB_USER", "root"),
+		DBPassword:         getEnv("DB_PASSWORD", "admin"),
+		DBAddress:          fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
+		DBName:             getEnv("DB_NAME", "project_manager"),
+		JWTSecret:          getEnv("JWT_SECRET", defaultJWTSecret),
+		JWTKeysDir:         getEnv("JWT_KEYS_DIR", ""),
+		JWTSigningKeyID:    getEnv("JWT_SIGNING_KID", ""),
+		JWTIssuer:          getEnv("JWT_ISSUER", "project-manager"),
+		JWTAudience:        getEnv("JWT_AUDIENCE", "project-manager-api"),
+		AccessTokenTTL:     getEnvDuration("JWT_ACCESS_TTL", 15*time.Minute),
+		RefreshTokenTTL:    getEnvDuration("JWT_REFRESH_TTL", 30*24*time.Hour),
+		RevocationBackend:  getEnv("REVOCATION_BACKEND", "sql"),
+		RevocationCacheTTL: getEnvDuration("REVOCATION_CACHE_TTL", 5*time.Second),
+		TrashRetention:     getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+		TrashPurgeInterval: getEnvDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		AppURL:             getEnv("APP_URL", "http://localhost:8080"),
+		MailDriver:         getEnv("MAIL_DRIVER", "log"),
+		MailFrom:           getEnv("MAIL_FROM", "Project Manager <no-reply@localhost>"),
+		MailFile:           getEnv("MAIL_FILE", "mail.log"),
+		MailMaxPerEmail:    getEnvInt("MAIL_MAX_PER_EMAIL", 3),
+		MailMaxPerIP:       getEnvInt("MAIL_MAX_PER_IP", 20),
+		MailThrottleWindow: getEnvDuration("MAIL_THROTTLE_WINDOW", time.Hour),
+		SMTPHost:           getEnv("SMTP_HOST", ""),
+		SMTPPort:           getEnv("SMTP_PORT", "587"),
+		SMTPUser:           getEnv("SMTP_USER", ""),
+		SMTPPassword:       getEnv("SMTP_PASSWORD", ""),
+		EmailVerifyTTL:     getEnvDuration("EMAIL_VERIFY_TTL", 24*time.Hour),
+		PasswordResetTTL:   getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		LoginMaxFailures:   getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginMaxIPFailures: getEnvInt("LOGIN_MAX_IP_FAILURES", 50),
+		LoginLockout:       getEnvDuration("LOGIN_LOCKOUT", time.Minute),
+		LoginLockoutMax:    getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+		LoginFailureWindow: getEnvDuration("LOGIN_FAILURE_WINDOW", 24*time.Hour),
+		TrustProxyHeaders:  getEnv("TRUST_PROXY_HEADERS", "false") == "true",
+		TwoFactorRequired:  getEnv("TWO_FACTOR_REQUIRED", "false") == "true",
+		TOTPIssuer:         getEnv("TOTP_ISSUER", "Project Manager"),
+		LoginChallengeTTL:  getEnvDuration("LOGIN_CHALLENGE_TTL", 5*time.Minute),
+		OIDCIssuer:         getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:       getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:    getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:         getEnv("OIDC_SCOPES", "openid email profile"),
 	}
 }
 
@@ -33,4 +119,62 @@ func getEnv(key, fallback string) string {
 	}
 
 	return fallback
-}
\ No newline at end of file
+}
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid duration for %s: %v", key, err)
+	}
+
+	return d
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid number for %s: %v", key, err)
+	}
+
+	return n
+}
+
+// validateConfig refuses settings the server cannot run with, and those that
+// are only safe for local development unless APP_ENV is development.
+func validateConfig(cfg Config) error {
+	if cfg.TrashRetention <= 0 {
+		return errTrashRetention
+	}
+
+	if cfg.TrashPurgeInterval <= 0 {
+		return errTrashPurgeInterval
+	}
+
+	if cfg.AppEnv == "development" {
+		return nil
+	}
+
+	if cfg.JWTKeysDir == "" && cfg.JWTSecret == defaultJWTSecret {
+		return errDefaultJWTSecret
+	}
+
+	if cfg.OIDCIssuer != "" && cfg.OIDCClientID == "" {
+		return errOIDCClientIDRequired
+	}
+
+	// the log and file mailers never deliver, users could not verify or reset
+	if cfg.MailDriver == "log" || cfg.MailDriver == "file" {
+		return errMailDriverDevelopment
+	}
+
+	return nil
+}
@@ -27,70 +27,19 @@ func NewMySQLStorage(cfg mysql.Config) *MySQLStorage {
 	return &MySQLStorage{db: db}
 }
 
-func (s *MySQLStorage) Init() (*sql.DB, error) {
-
-	if err := s.createUsersTable(); err != nil {
-		return nil, err
-	}
+func (s *MySQLStorage) Migrator() (*Migrator, error) {
+	return NewMigrator(s.db, "mysql")
+}
 
-	if err := s.createProjectsTable(); err != nil {
+func (s *MySQLStorage) Init() (*sql.DB, error) {
+	m, err := s.Migrator()
+	if err != nil {
 		return nil, err
 	}
 
-	if err := s.createTasksTable(); err != nil {
+	if err := m.Up(); err != nil {
 		return nil, err
 	}
 
 	return s.db, nil
 }
-
-func (s *MySQLStorage) createTasksTable() error {
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS tasks (
-			id INT UNSIGNED NOT NULL AUTO_INCREMENT,
-			name VARCHAR(255) NOT NULL,
-			status ENUM('TODO', 'IN_PROGRESS', 'IN_TESTING', 'DONE') NOT NULL DEFAULT 'TODO',
-			projectId INT UNSIGNED NOT NULL,
-			assignedToId INT UNSIGNED NOT NULL,
-			createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-
-			PRIMARY KEY (id),
-			FOREIGN KEY (assignedToId) REFERENCES users(id),
-			FOREIGN KEY (projectId) REFERENCES projects(id) ON DELETE CASCADE
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8;
-	`)
-
-	return err
-}
-
-func (s *MySQLStorage) createUsersTable() error {
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id INT UNSIGNED NOT NULL AUTO_INCREMENT,
-			email VARCHAR(255) NOT NULL,
-			firstName VARCHAR(255) NOT NULL,
-			lastName VARCHAR(255) NOT NULL,
-			password VARCHAR(255) NOT NULL,
-			createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-
-			PRIMARY KEY (id),
-			UNIQUE KEY (email)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8;
-	`)
-
-	return err
-}
-
-func (s *MySQLStorage) createProjectsTable() error {
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS projects (
-			id INT UNSIGNED NOT NULL AUTO_INCREMENT,
-			name VARCHAR(255) NOT NULL,
-			createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-
-			PRIMARY KEY (id)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8;
-	`)
-
-	return err
-}
\ No newline at end of file
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *TasksService) handleGetSubtasks(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	subtasks, err := s.store.GetSubtasks(task.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing subtasks"})
+		return
+	}
+
+	workflow, err := s.store.GetWorkflow(task.ProjectID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the workflow"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, &SubtaskList{Subtasks: subtasks, Progress: rollUp(workflow, subtasks)})
+}
+
+// handleSetParent moves the task under another task of the same project, or
+// back to the top level when parentId is zero.
+func (s *TasksService) handleSetParent(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *TaskParentPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if payload.ParentID != 0 && !s.checkRelatedTask(w, task, payload.ParentID) {
+		return
+	}
+
+	t, err := s.store.SetTaskParent(task.ID, payload.ParentID, GetUserIDFromContext(r.Context()))
+	if errors.Is(err, errDependencyCycle) {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while updating the task"})
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(t))
+	WriteJSON(w, http.StatusOK, t)
+}
+
+func (s *TasksService) handleGetDependencies(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	s.writeDependencies(w, http.StatusOK, task)
+}
+
+// handleAddDependency records that blockerId blocks the task.
+func (s *TasksService) handleAddDependency(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *TaskDependencyPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil || payload.BlockerID == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if !s.checkRelatedTask(w, task, payload.BlockerID) {
+		return
+	}
+
+	err = s.store.AddTaskDependency(payload.BlockerID, task.ID, GetUserIDFromContext(r.Context()))
+	if errors.Is(err, errDependencyCycle) || errors.Is(err, errDependencyExists) {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while adding the dependency"})
+		return
+	}
+
+	s.writeDependencies(w, http.StatusCreated, task)
+}
+
+func (s *TasksService) handleRemoveDependency(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
+		return
+	}
+
+	blockerID, err := parseIDParam(mux.Vars(r)["blockerId"])
+	if err != nil || blockerID == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidID.Error()})
+		return
+	}
+
+	err = s.store.RemoveTaskDependency(blockerID, task.ID, GetUserIDFromContext(r.Context()))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "dependency not found"})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while removing the dependency"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *TasksService) writeDependencies(w http.ResponseWriter, status int, task *Task) {
+	blockedBy, err := s.store.GetTaskBlockers(task.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing dependencies"})
+		return
+	}
+
+	blocks, err := s.store.GetBlockedTasks(task.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing dependencies"})
+		return
+	}
+
+	WriteJSON(w, status, &TaskDependencies{BlockedBy: blockedBy, Blocks: blocks})
+}
+
+// checkRelatedTask makes sure a parent or blocker exists, is another task and
+// belongs to the same project as task.
+func (s *TasksService) checkRelatedTask(w http.ResponseWriter, task *Task, relatedID int64) bool {
+	if relatedID == task.ID {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errDependencyCycle.Error()})
+		return false
+	}
+
+	related, err := s.store.GetTask(strconv.FormatInt(relatedID, 10))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("task %d not found", relatedID)})
+		return false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the task"})
+		return false
+	}
+
+	if related.ProjectID != task.ProjectID {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errSameProject.Error()})
+		return false
+	}
+
+	return true
+}
+
+// checkBlockers refuses to move a task into a terminal state while tasks
+// blocking it are still open.
+func (s *TasksService) checkBlockers(w http.ResponseWriter, workflow *Workflow, task *Task) bool {
+	blockers, err := s.store.GetTaskBlockers(task.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing dependencies"})
+		return false
+	}
+
+	open := []string{}
+	for _, b := range blockers {
+		if state := workflow.State(b.Status); state == nil || !state.Terminal {
+			open = append(open, strconv.FormatInt(b.ID, 10))
+		}
+	}
+
+	if len(open) > 0 {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("%s: %s, pass force=true to override", errOpenBlockers, strings.Join(open, ", "))})
+		return false
+	}
+
+	return true
+}
+
+// rollUp counts the subtasks in a terminal state of the workflow.
+func rollUp(workflow *Workflow, subtasks []*Task) *TaskProgress {
+	progress := &TaskProgress{Total: len(subtasks)}
+
+	for _, t := range subtasks {
+		if state := workflow.State(t.Status); state != nil && state.Terminal {
+			progress.Done++
+		}
+	}
+
+	if progress.Total > 0 {
+		progress.Percent = progress.Done * 100 / progress.Total
+	}
+
+	return progress
+}
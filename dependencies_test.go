@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTaskGraph(t *testing.T) {
+	store := newTestStore(t)
+
+	u, p := newTestProject(t, store)
+
+	tasks := make([]*Task, 3)
+	for i := range tasks {
+		var err error
+		tasks[i], err = store.CreateTask(&CreateTaskPayload{Name: "task " + strconv.Itoa(i), Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b, c := tasks[0].ID, tasks[1].ID, tasks[2].ID
+
+	t.Run("should refuse dependency cycles", func(t *testing.T) {
+		if err := store.AddTaskDependency(a, b, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddTaskDependency(b, c, u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.AddTaskDependency(c, a, u.ID); err != errDependencyCycle {
+			t.Errorf("expected %v, got %v", errDependencyCycle, err)
+		}
+		if err := store.AddTaskDependency(a, b, u.ID); err != errDependencyExists {
+			t.Errorf("expected %v, got %v", errDependencyExists, err)
+		}
+
+		blockers, err := store.GetTaskBlockers(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blockers) != 1 || blockers[0].ID != b {
+			t.Errorf("expected task %d to block task %d, got %v", b, c, blockers)
+		}
+	})
+
+	t.Run("should refuse parent cycles", func(t *testing.T) {
+		if _, err := store.SetTaskParent(b, a, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.SetTaskParent(c, b, u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.SetTaskParent(a, c, u.ID); err != errDependencyCycle {
+			t.Errorf("expected %v, got %v", errDependencyCycle, err)
+		}
+
+		subtasks, err := store.GetSubtasks(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subtasks) != 1 || subtasks[0].ID != b {
+			t.Errorf("expected task %d to be the only subtask, got %v", b, subtasks)
+		}
+	})
+
+	t.Run("should keep subtasks under deleted tasks", func(t *testing.T) {
+		if err := store.DeleteTask(strconv.FormatInt(b, 10), u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		// the parent is only in the trash, it may still be restored
+		task, err := store.GetTask(strconv.FormatInt(c, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.ParentID != b {
+			t.Errorf("expected parent %d, got %d", b, task.ParentID)
+		}
+
+		subtasks, err := store.GetSubtasks(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subtasks) != 0 {
+			t.Errorf("expected the deleted subtask to be hidden, got %v", subtasks)
+		}
+
+		blockers, err := store.GetTaskBlockers(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blockers) != 0 {
+			t.Errorf("expected no blockers, got %v", blockers)
+		}
+	})
+}
+
+func TestCloseBlockedTask(t *testing.T) {
+	ms := &MockStore{}
+	service := NewTasksService(ms)
+
+	patch := func(url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPatch, url, strings.NewReader(`{"status":"DONE"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", mergePatchContentType)
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks/{id}", service.handlePatchTask)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		return rr
+	}
+
+	t.Run("should refuse to close a task with open blockers", func(t *testing.T) {
+		rr := patch("/tasks/1")
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should close a blocked task when forced", func(t *testing.T) {
+		rr := patch("/tasks/1?force=true")
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+func TestRollUp(t *testing.T) {
+	subtasks := []*Task{{Status: StatusDone}, {Status: StatusTODO}, {Status: StatusInTesting}, {Status: StatusDone}}
+
+	progress := rollUp(DefaultWorkflow(1), subtasks)
+	if progress.Total != 4 || progress.Done != 2 || progress.Percent != 50 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+}
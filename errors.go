@@ -11,3 +11,96 @@ var errLastNameRequired = errors.New("last name is required")
 var errPasswordRequired = errors.New("password is required")
 var errStatusRequired = errors.New("status is required")
 var invalidStatus = errors.New("invalid status")
+var errInvalidCursor = errors.New("invalid cursor")
+var errCursorMismatch = errors.New("cursor was issued for another sort or order")
+var errInvalidLimit = errors.New("invalid limit")
+var errInvalidSort = errors.New("invalid sort field")
+var errInvalidOrder = errors.New("invalid sort order")
+var errInvalidDate = errors.New("invalid date, expected RFC 3339")
+var errInvalidID = errors.New("invalid id")
+var errMigrationModified = errors.New("applied migration was modified")
+var errMigrationLocked = errors.New("could not acquire the migration lock")
+var errMigrateUsage = errors.New("usage: migrate up | down [steps] | status")
+var errRoleRequired = errors.New("role is required")
+var errInvalidRole = errors.New("invalid role")
+var errLastOwner = errors.New("a project needs at least one owner")
+var errAssigneeNotMember = errors.New("assignee is not a member of the project")
+var errMissingClaims = errors.New("token is missing required claims")
+var errInvalidIssuer = errors.New("invalid token issuer")
+var errInvalidAudience = errors.New("invalid token audience")
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+var errRefreshTokenRequired = errors.New("refresh token is required")
+var errNoSigningKey = errors.New("no private key to sign tokens with")
+var errInvalidKey = errors.New("unsupported key, expected an RSA or Ed25519 PEM key")
+var errDefaultJWTSecret = errors.New("refusing to start with the default JWT_SECRET, set JWT_SECRET or JWT_KEYS_DIR, or APP_ENV=development")
+var errCommentBodyRequired = errors.New("comment body is required")
+var errCommentTooLong = errors.New("comment body is too long")
+var errForeignKeyViolation = errors.New("migration left foreign key violations")
+var errStatesRequired = errors.New("a workflow needs at least one state")
+var errDuplicateState = errors.New("duplicate workflow state")
+var errInitialState = errors.New("a workflow needs exactly one initial state")
+var errTerminalState = errors.New("a workflow needs at least one terminal state")
+var errInvalidTransition = errors.New("transitions must connect two different states of the workflow")
+var errTransitionNotAllowed = errors.New("transition not allowed")
+var errStatesInUse = errors.New("tasks are still in states the workflow removes")
+var errVersionConflict = errors.New("task was modified, reload it and retry")
+var errStatusChanged = errors.New("task status changed since the transition was checked, reload it and retry")
+var errUnsupportedPatch = errors.New("expected an application/merge-patch+json body")
+var errInvalidPatch = errors.New("merge patch must be a JSON object")
+var errWeakETag = errors.New("If-Match needs a strong entity tag")
+var errInvalidPriority = errors.New("invalid priority, expected LOW, MEDIUM, HIGH or URGENT")
+var errDescriptionTooLong = errors.New("description is too long")
+var errInvalidDateRange = errors.New("start date must not be after the due date")
+var errInvalidEstimate = errors.New("estimate must be between 0 and 1000 story points")
+var errInvalidTimeSpent = errors.New("time spent must not be negative")
+var errDependencyCycle = errors.New("dependency would create a cycle")
+var errDependencyExists = errors.New("dependency already exists")
+var errSameProject = errors.New("tasks must belong to the same project")
+var errOpenBlockers = errors.New("task is blocked by open tasks")
+var errLabelExists = errors.New("the project already has a label with this name")
+var errInvalidColor = errors.New("invalid color, expected #rrggbb")
+var errNameTooLong = errors.New("name is too long")
+var errSearchQueryRequired = errors.New("search query is required")
+var errSearchQueryTooLong = errors.New("search query is too long")
+var errInvalidSearchType = errors.New("invalid type, expected task, project or comment")
+var errProjectArchived = errors.New("project is archived, restore it first")
+var errProjectNotArchived = errors.New("project is not archived")
+var errOwnerNotMember = errors.New("owner must be a member of the project")
+var errOnlyOwnerTransfers = errors.New("only owners can change the project owner")
+var errInvalidTrashType = errors.New("invalid type, expected task or project")
+var errProjectDeleted = errors.New("the project is in the trash, restore it first")
+var errCurrentPasswordRequired = errors.New("current password is required")
+var errWrongPassword = errors.New("current password is incorrect")
+var errInvalidEmail = errors.New("invalid email address")
+var errEmailTaken = errors.New("email is already in use")
+var errSoleOwner = errors.New("you are the only owner of some projects, hand them over or delete them first")
+var errDeleteConfirmation = errors.New("deleting a project removes all its tasks, pass confirm=<project name> to proceed")
+var errSMTPHostRequired = errors.New("SMTP_HOST is required for MAIL_DRIVER=smtp")
+var errMailDriverDevelopment = errors.New("refusing to start with MAIL_DRIVER=log or file outside development, set MAIL_DRIVER=smtp or APP_ENV=development")
+var errEmailNotVerified = errors.New("email is not verified, check your inbox or ask for a new link")
+var errTokenRequired = errors.New("token is required")
+var errInvalidUserToken = errors.New("invalid or expired token")
+var errInvalidCredentials = errors.New("invalid email or password")
+var errTooManyLogins = errors.New("too many failed logins, try again later")
+var errTooManyEmails = errors.New("too many emails requested, try again later")
+var errAdminRequired = errors.New("administrators only")
+var errTwoFactorCodeRequired = errors.New("code or recovery code is required")
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+var errTwoFactorNotEnrolled = errors.New("start the two-factor enrollment first")
+var errTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+var errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+var errTwoFactorRequired = errors.New("two-factor authentication is required and cannot be disabled")
+var errScopesRequired = errors.New("at least one scope is required")
+var errInvalidScope = errors.New("invalid scope, expected tasks:read, tasks:write, projects:read, projects:write or projects:admin")
+var errExpiryInPast = errors.New("expiresAt must be in the future")
+var errInsufficientScope = errors.New("the access token lacks the scope for this request")
+var errAccessTokenNotAllowed = errors.New("personal access tokens cannot be used for this request")
+var errOIDCClientIDRequired = errors.New("OIDC_CLIENT_ID is required with OIDC_ISSUER")
+var errTrashRetention = errors.New("TRASH_RETENTION must be a positive duration")
+var errTrashPurgeInterval = errors.New("TRASH_PURGE_INTERVAL must be a positive duration")
+var errOIDCUnavailable = errors.New("the identity provider is unavailable")
+var errInvalidOIDCState = errors.New("invalid or expired login state, start the login again")
+var errOIDCLoginFailed = errors.New("the identity provider login could not be verified")
+var errOIDCEmailNotVerified = errors.New("the identity provider did not verify the email")
+var errOIDCUnverifiedAccount = errors.New("an unverified account uses this email, verify it before signing in with single sign-on")
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	EntityTask    = "task"
+	EntityProject = "project"
+)
+
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionDeleted  = "deleted"
+	ActionArchived = "archived"
+	ActionRestored = "restored"
+)
+
+// taskFields are the task fields recorded in the audit trail.
+func taskFields(t *Task) map[string]any {
+	if t == nil {
+		return nil
+	}
+
+	return map[string]any{
+		"name":             t.Name,
+		"status":           t.Status,
+		"assignedToId":     t.AssignedToID,
+		"parentId":         nullID(t.ParentID),
+		"description":      t.Description,
+		"priority":         t.Priority,
+		"startDate":        fieldTime(t.StartDate),
+		"dueDate":          fieldTime(t.DueDate),
+		"estimate":         fieldInt(t.Estimate),
+		"timeSpentMinutes": t.TimeSpentMinutes,
+	}
+}
+
+// fieldTime and fieldInt turn optional fields into comparable values, nil
+// when they are not set.
+func fieldTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func fieldInt(n *int) any {
+	if n == nil {
+		return nil
+	}
+
+	return *n
+}
+
+// projectFields are the project fields recorded in the audit trail.
+func projectFields(p *Project) map[string]any {
+	if p == nil {
+		return nil
+	}
+
+	return map[string]any{
+		"name":        p.Name,
+		"description": p.Description,
+		"ownerId":     nullID(p.OwnerID),
+		"archivedAt":  fieldTime(p.ArchivedAt),
+	}
+}
+
+// diffFields lists the fields whose value differs between before and after,
+// sorted by name. Either side may be nil for created and deleted entities.
+func diffFields(before, after map[string]any) []*FieldChange {
+	names := map[string]bool{}
+	for name := range before {
+		names[name] = true
+	}
+	for name := range after {
+		names[name] = true
+	}
+
+	changes := []*FieldChange{}
+	for name := range names {
+		from, to := before[name], after[name]
+		if from != to {
+			changes = append(changes, &FieldChange{Field: name, From: from, To: to})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
+
+func (s *TasksService) handleGetTaskHistory(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeEventPage(s.store, w, r, &EventFilter{TaskID: task.ID})
+}
+
+func (s *ProjectService) handleGetProjectActivity(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeEventPage(s.store, w, r, &EventFilter{ProjectID: project.ID})
+}
+
+// writeEventPage writes a page of events, newest first, continuing from the
+// cursor in the query string.
+func writeEventPage(store Store, w http.ResponseWriter, r *http.Request, filter *EventFilter) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if c != nil {
+		filter.BeforeID = c.ID
+	}
+
+	// fetch one extra event to know whether there is a next page
+	filter.Limit = limit + 1
+
+	events, err := store.ListEvents(filter)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing events"})
+		return
+	}
+
+	page := &EventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = encodeCursor(cursor{ID: page.Events[limit-1].ID})
+	}
+
+	WriteJSON(w, http.StatusOK, page)
+}
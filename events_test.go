@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDiffFields(t *testing.T) {
+	before := &Task{Name: "Gears", Status: StatusTODO, AssignedToID: 1}
+	after := &Task{Name: "Gears", Status: StatusDone, AssignedToID: 2}
+
+	changes := diffFields(taskFields(before), taskFields(after))
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+
+	if changes[0].Field != "assignedToId" || changes[0].From != int64(1) || changes[0].To != int64(2) {
+		t.Errorf("unexpected change %+v", changes[0])
+	}
+
+	if changes[1].Field != "status" || changes[1].From != StatusTODO || changes[1].To != StatusDone {
+		t.Errorf("unexpected change %+v", changes[1])
+	}
+
+	// unset optional fields are left out of created events
+	created := diffFields(nil, taskFields(after))
+	for _, c := range created {
+		if c.From != nil || c.To == nil {
+			t.Errorf("unexpected change of a created task %+v", c)
+		}
+	}
+	if len(created) != 6 {
+		t.Errorf("expected 6 changes, got %d", len(created))
+	}
+}
+
+func TestAuditTrail(t *testing.T) {
+	store := newTestStore(t)
+
+	u, p := newTestProject(t, store)
+
+	task, err := store.CreateTask(&CreateTaskPayload{Name: "Gears", Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := strconv.FormatInt(task.ID, 10)
+
+	if _, err := store.EditTask(id, &EditTaskPayload{Name: "Gears", Status: StatusDone, AssignedToID: u.ID}, StatusTODO, 0, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// saving without changes is not an event
+	if _, err := store.EditTask(id, &EditTaskPayload{Name: "Gears", Status: StatusDone, AssignedToID: u.ID}, StatusDone, 0, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.DeleteTask(id, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should record the task history", func(t *testing.T) {
+		events, err := store.ListEvents(&EventFilter{TaskID: task.ID, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(events) != 3 {
+			t.Fatalf("expected 3 events, got %d", len(events))
+		}
+
+		actions := []string{ActionDeleted, ActionUpdated, ActionCreated}
+		for i, e := range events {
+			if e.Action != actions[i] || e.ActorID != u.ID || e.EntityType != EntityTask {
+				t.Errorf("unexpected event %d %+v", i, e)
+			}
+		}
+
+		changes := events[1].Changes
+		if len(changes) != 1 || changes[0].Field != "status" || changes[0].From != StatusTODO || changes[0].To != StatusDone {
+			t.Errorf("unexpected changes %+v", changes)
+		}
+	})
+
+	t.Run("should page the project activity", func(t *testing.T) {
+		events, err := store.ListEvents(&EventFilter{ProjectID: p.ID, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(events) != 2 {
+			t.Fatalf("expected 2 events, got %d", len(events))
+		}
+
+		rest, err := store.ListEvents(&EventFilter{ProjectID: p.ID, BeforeID: events[1].ID, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rest) != 2 || rest[1].EntityType != EntityProject || rest[1].Action != ActionCreated {
+			t.Errorf("expected the task and project creation, got %+v", rest)
+		}
+	})
+}
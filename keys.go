@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// SigningKey is one JWT key. Keys loaded from a public key file only verify
+// tokens, which is how retired keys are kept during a rotation.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Private signs tokens, it is nil for verify-only keys.
+	Private any
+	// Public verifies tokens.
+	Public any
+}
+
+// KeySet holds every key tokens are verified with and the one new tokens are
+// signed with.
+type KeySet struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+// signingKeys is replaced at startup by the keys in Envs.JWTKeysDir.
+var signingKeys = NewHMACKeySet([]byte(Envs.JWTSecret))
+
+// NewHMACKeySet signs and verifies with a shared secret, used when no key
+// directory is configured.
+func NewHMACKeySet(secret []byte) *KeySet {
+	key := &SigningKey{ID: "hs256", Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+	return &KeySet{signing: key, keys: map[string]*SigningKey{key.ID: key}}
+}
+
+// LoadKeySet reads the keys in dir. Private keys are named <kid>.pem and
+// public keys <kid>.pub.pem. New tokens are signed with signingKID, or with
+// the private key whose kid sorts last when it is empty.
+func LoadKeySet(dir, signingKID string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: map[string]*SigningKey{}}
+	var private []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		kid := strings.TrimSuffix(strings.TrimSuffix(name, ".pem"), ".pub")
+		key, err := parseSigningKey(kid, b)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", name, err)
+		}
+
+		// a private key also carries the public half
+		if existing, ok := set.keys[kid]; ok && existing.Private != nil {
+			continue
+		}
+		set.keys[kid] = key
+
+		if key.Private != nil {
+			private = append(private, kid)
+		}
+	}
+
+	if signingKID == "" && len(private) > 0 {
+		sort.Strings(private)
+		signingKID = private[len(private)-1]
+	}
+
+	set.signing = set.keys[signingKID]
+	if set.signing == nil || set.signing.Private == nil {
+		return nil, fmt.Errorf("%w: %q", errNoSigningKey, signingKID)
+	}
+
+	return set, nil
+}
+
+func parseSigningKey(kid string, b []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errInvalidKey
+	}
+
+	var parsed any
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, errInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: kid}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, errInvalidKey
+	}
+
+	return key, nil
+}
+
+// Sign signs the claims with the current signing key and sets its kid.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+
+	return token.SignedString(ks.signing.Private)
+}
+
+// Keyfunc finds the key a token was signed with from its kid, and makes sure
+// the token uses that key's algorithm.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	// tokens issued before key ids existed are signed with the secret
+	if kid == "" && ks.signing.Method == jwt.SigningMethodHS256 {
+		kid = ks.signing.ID
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set. Shared secrets are never published.
+func (ks *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{Keys: []*JWK{}}
+
+	for _, key := range ks.keys {
+		jwk := &JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
+
+func handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	WriteJSON(w, http.StatusOK, signingKeys.JWKS())
+}
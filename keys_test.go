@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+
+	"testing"
+)
+
+func writeKey(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+
+	b := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := signingKeys
+	t.Cleanup(func() { signingKeys = old })
+
+	// before the rotation only the RSA key exists
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	signingKeys, err = LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken, err := CreateJWT(signingKeys, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// after the rotation the RSA key only verifies and Ed25519 signs
+	dir = t.TempDir()
+	writeKey(t, dir, "2024-01.pub.pem", "PUBLIC KEY", rsaPubDER)
+	writeKey(t, dir, "2024-06.pem", "PRIVATE KEY", edDER)
+
+	signingKeys, err = LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should sign with the newest key", func(t *testing.T) {
+		token, err := CreateJWT(signingKeys, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed, err := validateJWT(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if kid := parsed.Header["kid"]; kid != "2024-06" {
+			t.Errorf("expected kid 2024-06, got %v", kid)
+		}
+		if alg := parsed.Method.Alg(); alg != "EdDSA" {
+			t.Errorf("expected alg EdDSA, got %s", alg)
+		}
+	})
+
+	t.Run("should verify tokens signed with the retired key", func(t *testing.T) {
+		if _, err := validateJWT(oldToken); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should reject tokens signed with an HMAC secret", func(t *testing.T) {
+		token, err := NewHMACKeySet([]byte(Envs.JWTSecret)).Sign(&TokenClaims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := validateJWT(token); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should publish both public keys", func(t *testing.T) {
+		jwks := signingKeys.JWKS()
+
+		if len(jwks.Keys) != 2 {
+			t.Fatalf("expected 2 keys, got %d", len(jwks.Keys))
+		}
+		if jwks.Keys[0].Kty != "RSA" || jwks.Keys[1].Kty != "OKP" {
+			t.Errorf("expected RSA and OKP keys, got %s and %s", jwks.Keys[0].Kty, jwks.Keys[1].Kty)
+		}
+	})
+
+	t.Run("should refuse a verify-only signing key", func(t *testing.T) {
+		if _, err := LoadKeySet(dir, "2024-01"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxLabelNameLength = 64
+	defaultLabelColor  = "#808080"
+)
+
+var labelColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func (s *ProjectService) handleGetLabels(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	labels, err := s.store.GetProjectLabels(project.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing labels"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, labels)
+}
+
+func (s *ProjectService) handleCreateLabel(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *LabelPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if err := validateLabelPayload(payload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	label, err := s.store.CreateLabel(project.ID, payload)
+	if errors.Is(err, errLabelExists) {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while creating the label"})
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, label)
+}
+
+func (s *ProjectService) handleDeleteLabel(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	label, ok := loadLabel(s.store, w, mux.Vars(r)["labelId"], project.ID)
+	if !ok {
+		return
+	}
+
+	if err := s.store.DeleteLabel(label.ID); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while deleting the label"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *TasksService) handleAddTaskLabel(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *TaskLabelPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil || payload.LabelID == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	label, ok := loadLabel(s.store, w, strconv.FormatInt(payload.LabelID, 10), task.ProjectID)
+	if !ok {
+		return
+	}
+
+	if err := s.store.AddTaskLabel(task.ID, label.ID, GetUserIDFromContext(r.Context())); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while adding the label"})
+		return
+	}
+
+	labels, err := s.store.GetTaskLabels(task.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing labels"})
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, labels)
+}
+
+func (s *TasksService) handleRemoveTaskLabel(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
+		return
+	}
+
+	labelID, err := parseIDParam(mux.Vars(r)["labelId"])
+	if err != nil || labelID == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidID.Error()})
+		return
+	}
+
+	err = s.store.RemoveTaskLabel(task.ID, labelID, GetUserIDFromContext(r.Context()))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "label not found"})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while removing the label"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// loadLabel loads a label of the project, labels of other projects are
+// reported as not found.
+func loadLabel(store Store, w http.ResponseWriter, id string, projectID int64) (*Label, bool) {
+	labelID, err := parseIDParam(id)
+	if err != nil || labelID == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidID.Error()})
+		return nil, false
+	}
+
+	label, err := store.GetLabel(labelID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && label.ProjectID != projectID) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "label not found"})
+		return nil, false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the label"})
+		return nil, false
+	}
+
+	return label, true
+}
+
+// parseIDList reads ids that may be repeated or comma separated, e.g.
+// ?labelAny=1,2&labelAny=3. Duplicates are dropped.
+func parseIDList(values []string) ([]int64, error) {
+	var ids []int64
+	seen := map[int64]bool{}
+
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			id, err := parseIDParam(part)
+			if err != nil || id == 0 {
+				return nil, errInvalidID
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+func validateLabelPayload(l *LabelPayload) error {
+	l.Name = strings.TrimSpace(l.Name)
+
+	if l.Name == "" {
+		return errNameRequired
+	}
+
+	if utf8.RuneCountInString(l.Name) > maxLabelNameLength {
+		return errNameTooLong
+	}
+
+	if l.Color == "" {
+		l.Color = defaultLabelColor
+	}
+
+	if !labelColorPattern.MatchString(l.Color) {
+		return errInvalidColor
+	}
+
+	l.Color = strings.ToLower(l.Color)
+
+	return nil
+}
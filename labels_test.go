@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestValidateLabelPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload LabelPayload
+		err     error
+	}{
+		{"valid", LabelPayload{Name: " bug ", Color: "#FF0000"}, nil},
+		{"default color", LabelPayload{Name: "bug"}, nil},
+		{"blank name", LabelPayload{Name: "  "}, errNameRequired},
+		{"invalid color", LabelPayload{Name: "bug", Color: "red"}, errInvalidColor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.payload
+			if err := validateLabelPayload(&p); err != tt.err {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	p := LabelPayload{Name: " bug ", Color: "#FF0000"}
+	validateLabelPayload(&p)
+	if p.Name != "bug" || p.Color != "#ff0000" {
+		t.Errorf("unexpected payload %+v", p)
+	}
+}
+
+func TestLabelFilters(t *testing.T) {
+	store := newTestStore(t)
+
+	u, p := newTestProject(t, store)
+
+	bug, err := store.CreateLabel(p.ID, &LabelPayload{Name: "bug", Color: "#ff0000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ui, err := store.CreateLabel(p.ID, &LabelPayload{Name: "ui", Color: "#00ff00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.CreateLabel(p.ID, &LabelPayload{Name: "bug", Color: "#0000ff"}); err != errLabelExists {
+		t.Errorf("expected %v, got %v", errLabelExists, err)
+	}
+
+	// task 0 has no label, task 1 is a bug, task 2 a ui bug
+	labels := [][]int64{nil, {bug.ID}, {bug.ID, ui.ID}}
+	ids := make([]int64, len(labels))
+	for i, taskLabels := range labels {
+		task, err := store.CreateTask(&CreateTaskPayload{Name: "task " + strconv.Itoa(i), Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = task.ID
+
+		for _, labelID := range taskLabels {
+			if err := store.AddTaskLabel(task.ID, labelID, u.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	list := func(f *TaskListFilter) []int64 {
+		f.Sort, f.Limit, f.MemberID = "id", 10, u.ID
+
+		page, err := store.ListTasks(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := []int64{}
+		for _, task := range page.Tasks {
+			found = append(found, task.ID)
+		}
+		sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+		return found
+	}
+
+	tests := []struct {
+		name     string
+		filter   *TaskListFilter
+		expected []int64
+	}{
+		{"any of", &TaskListFilter{LabelsAny: []int64{bug.ID, ui.ID}}, []int64{ids[1], ids[2]}},
+		{"all of", &TaskListFilter{LabelsAll: []int64{bug.ID, ui.ID}}, []int64{ids[2]}},
+		{"none of", &TaskListFilter{LabelsNone: []int64{ui.ID}}, []int64{ids[0], ids[1]}},
+		{"combined", &TaskListFilter{LabelsAny: []int64{bug.ID}, LabelsNone: []int64{ui.ID}}, []int64{ids[1]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := list(tt.filter)
+			if len(found) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, found)
+			}
+			for i := range found {
+				if found[i] != tt.expected[i] {
+					t.Fatalf("expected %v, got %v", tt.expected, found)
+				}
+			}
+		})
+	}
+
+	t.Run("should add a label once", func(t *testing.T) {
+		before, err := store.ListEvents(&EventFilter{TaskID: ids[1], Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.AddTaskLabel(ids[1], bug.ID, u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := store.ListEvents(&EventFilter{TaskID: ids[1], Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(after) != len(before) {
+			t.Errorf("expected no new event, got %d events instead of %d", len(after), len(before))
+		}
+	})
+
+	t.Run("should delete labels with their project", func(t *testing.T) {
+		if err := store.PurgeProject(p.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.GetLabel(bug.ID); err == nil {
+			t.Error("expected the label to be deleted with its project")
+		}
+
+		var rows int
+		if err := store.db.QueryRow("SELECT COUNT(*) FROM task_labels").Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		if rows != 0 {
+			t.Errorf("expected no task labels, got %d", rows)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	LockoutKindAccount = "account"
+	LockoutKindIP      = "ip"
+)
+
+// loginSubjects are what failed logins are counted against: the email,
+// whether or not it has an account, and the client IP.
+func loginSubjects(r *http.Request, email string) map[string]string {
+	return map[string]string{
+		LockoutKindAccount: strings.ToLower(strings.TrimSpace(email)),
+		LockoutKindIP:      clientIP(r),
+	}
+}
+
+// clientIP is the address of the caller. X-Forwarded-For is only trusted
+// behind a proxy, where its last entry is the address the proxy saw.
+func clientIP(r *http.Request) string {
+	if Envs.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// lockoutDuration is how long a subject is locked after failures, nothing
+// below max and doubling with every failure after that up to LoginLockoutMax.
+func lockoutDuration(failures, max int) time.Duration {
+	if max <= 0 || failures < max {
+		return 0
+	}
+
+	d := float64(Envs.LoginLockout) * math.Pow(2, float64(failures-max))
+	if d > float64(Envs.LoginLockoutMax) {
+		return Envs.LoginLockoutMax
+	}
+
+	return time.Duration(d)
+}
+
+// loginLockedUntil returns the latest lock of the subjects, the zero time
+// when none is locked.
+func (s *UserService) loginLockedUntil(subjects map[string]string) (time.Time, error) {
+	var until time.Time
+
+	for kind, subject := range subjects {
+		t, err := s.store.GetLoginLock(kind, subject)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t.After(until) {
+			until = t
+		}
+	}
+
+	return until, nil
+}
+
+// recordLoginFailure counts the failure against every subject and locks the
+// ones over their limit. userID is 0 for unknown emails.
+func (s *UserService) recordLoginFailure(subjects map[string]string, ip string, userID int64) error {
+	now := time.Now()
+
+	for kind, subject := range subjects {
+		failures, err := s.store.RecordLoginFailure(kind, subject, now, Envs.LoginFailureWindow)
+		if err != nil {
+			return err
+		}
+
+		max := Envs.LoginMaxFailures
+		if kind == LockoutKindIP {
+			max = Envs.LoginMaxIPFailures
+		}
+
+		d := lockoutDuration(failures, max)
+		if d == 0 {
+			continue
+		}
+
+		lockout := &Lockout{
+			Kind:        kind,
+			Subject:     subject,
+			IP:          ip,
+			Failures:    failures,
+			LockedUntil: now.Add(d),
+		}
+		if kind == LockoutKindAccount {
+			lockout.UserID = userID
+		}
+
+		if err := s.store.LockLogin(lockout); err != nil {
+			return err
+		}
+
+		log.Printf("login locked for %s %q until %s after %d failures", kind, subject, lockout.LockedUntil.Format(time.RFC3339), failures)
+	}
+
+	return nil
+}
+
+// tooManyLogins answers a locked login the same way for every email.
+func tooManyLogins(w http.ResponseWriter, until time.Time) {
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	WriteJSON(w, http.StatusTooManyRequests, ErrorResponse{Error: errTooManyLogins.Error()})
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyPassword spends the time of a password check for emails without
+// an account, so response times do not tell which emails exist.
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	})
+
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+type LockoutService struct {
+	store Store
+}
+
+func NewLockoutService(s Store) *LockoutService {
+	return &LockoutService{store: s}
+}
+
+func (s *LockoutService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/admin/lockouts", WithJWTAuth(s.handleGetLockouts, s.store)).Methods("GET")
+	r.HandleFunc("/admin/lockouts/{id}/clear", WithJWTAuth(s.handleClearLockout, s.store)).Methods("POST")
+}
+
+// handleGetLockouts lists the lockouts, newest first. ?active=true keeps the
+// ones still in force.
+func (s *LockoutService) handleGetLockouts(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c, err := decodeCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var beforeID int64
+	if c != nil {
+		beforeID = c.ID
+	}
+
+	activeOnly := r.URL.Query().Get("active") == "true"
+
+	// fetch one extra lockout to know whether there is a next page
+	lockouts, err := s.store.ListLockouts(activeOnly, beforeID, limit+1)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing lockouts"})
+		return
+	}
+
+	page := &LockoutPage{Lockouts: lockouts}
+	if len(lockouts) > limit {
+		page.Lockouts = lockouts[:limit]
+		page.NextCursor = encodeCursor(cursor{ID: page.Lockouts[limit-1].ID})
+	}
+
+	WriteJSON(w, http.StatusOK, page)
+}
+
+// handleClearLockout lifts a lockout before it runs out, along with the
+// failures counted against its account or IP.
+func (s *LockoutService) handleClearLockout(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	id, err := parseIDParam(mux.Vars(r)["id"])
+	if err != nil || id == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidID.Error()})
+		return
+	}
+
+	lockout, err := s.store.ClearLockout(id, GetUserIDFromContext(r.Context()))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "lockout not found"})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while clearing the lockout"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, lockout)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{4, 0},
+		{5, Envs.LoginLockout},
+		{6, 2 * Envs.LoginLockout},
+		{8, 8 * Envs.LoginLockout},
+		{100, Envs.LoginLockoutMax},
+	}
+
+	for _, tt := range tests {
+		if d := lockoutDuration(tt.failures, 5); d != tt.expected {
+			t.Errorf("expected %s after %d failures, got %s", tt.expected, tt.failures, d)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	store := newTestStore(t)
+	service := NewUserService(store, NewLogMailer("", bytes.NewBuffer(nil)))
+
+	router := mux.NewRouter()
+	service.RegisterRoutes(router)
+
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := newTestUser(t, store)
+	if err := store.UpdateUserPassword(u.ID, hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.MarkEmailVerified(u.ID, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/users/login", bytes.NewBufferString(`{"email":"`+email+`","password":"`+password+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = "192.0.2.1:1234"
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should not tell unknown emails from wrong passwords", func(t *testing.T) {
+		unknown := login("nobody@example.com", "secret")
+		wrong := login("ada@example.com", "guess")
+
+		if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d and %d", http.StatusUnauthorized, unknown.Code, wrong.Code)
+		}
+		if unknown.Body.String() != wrong.Body.String() {
+			t.Errorf("expected the same error, got %q and %q", unknown.Body, wrong.Body)
+		}
+	})
+
+	t.Run("should lock the account after too many failures", func(t *testing.T) {
+		// failures count against the email whatever its case
+		for i := 1; i < Envs.LoginMaxFailures; i++ {
+			email := "ada@example.com"
+			if i%2 == 1 {
+				email = "ADA@example.com"
+			}
+			login(email, "guess")
+		}
+
+		rr := login("ada@example.com", "secret")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+
+		lockouts, err := store.ListLockouts(true, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lockouts) != 1 || lockouts[0].Kind != LockoutKindAccount || lockouts[0].UserID != u.ID || lockouts[0].IP != "192.0.2.1" {
+			t.Fatalf("unexpected lockouts %v", lockouts)
+		}
+
+		if _, err := store.ClearLockout(lockouts[0].ID, u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if rr := login("ada@example.com", "secret"); rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d once cleared, got %d", http.StatusCreated, rr.Code)
+		}
+
+		if lockouts, err = store.ListLockouts(true, 0, 10); err != nil {
+			t.Fatal(err)
+		}
+		if len(lockouts) != 0 {
+			t.Errorf("expected no active lockouts, got %d", len(lockouts))
+		}
+	})
+
+	t.Run("should count wrong current passwords", func(t *testing.T) {
+		change := func(password string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(http.MethodPut, "/users/me/password", bytes.NewBufferString(`{"currentPassword":"`+password+`","newPassword":"another secret"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = "192.0.2.1:1234"
+
+			rr := httptest.NewRecorder()
+			service.handleChangePassword(rr, withUserID(req, u.ID))
+			return rr
+		}
+
+		for i := 0; i < Envs.LoginMaxFailures; i++ {
+			if rr := change("guess"); rr.Code != http.StatusForbidden {
+				t.Fatalf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+			}
+		}
+
+		if rr := change("secret"); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+	})
+}
+
+func TestGetLockouts(t *testing.T) {
+	ms := &MockStore{}
+	service := NewLockoutService(ms)
+
+	list := func(role string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/admin/lockouts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = req.WithContext(ContextWithPrincipal(req.Context(), &Principal{UserID: 1, Roles: []string{role}}))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/admin/lockouts", service.handleGetLockouts)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	if rr := list(UserRoleUser); rr.Code != http.StatusForbidden {
+		t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+	}
+
+	if rr := list(UserRoleAdmin); rr.Code != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatMessage(t *testing.T) {
+	msg := string(formatMessage("no-reply@example.com", &Message{
+		To:      "ada@example.com\r\nBcc: eve@example.com",
+		Subject: "Hello",
+		Body:    "line one\nline two",
+	}))
+
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Errorf("expected no injected header in %q", msg)
+	}
+
+	if !strings.Contains(msg, "Subject: Hello\r\n") || !strings.HasSuffix(msg, "\r\n\r\nline one\r\nline two\r\n") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
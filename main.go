@@ -1,31 +1,97 @@
 package main
 
 import (
+	"database/sql"
 	"log"
+	"os"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
 func main() {
-	cfg := mysql.Config{
-		User:                 Envs.DBUser,
-		Passwd:               Envs.DBPassword,
-		Addr:                 Envs.DBAddress,
-		DBName:               Envs.DBName,
-		Net:                  "tcp",
-		AllowNativePasswords: true,
-		ParseTime:            true,
+	var storage interface {
+		Init() (*sql.DB, error)
+		Migrator() (*Migrator, error)
 	}
 
-	sqlStorage := NewMySQLStorage(cfg)
+	switch Envs.DBDriver {
+	case "mysql":
+		cfg := mysql.Config{
+			User:                 Envs.DBUser,
+			Passwd:               Envs.DBPassword,
+			Addr:                 Envs.DBAddress,
+			DBName:               Envs.DBName,
+			Net:                  "tcp",
+			AllowNativePasswords: true,
+			ParseTime:            true,
+			// sqlTime writes UTC, so the session reads and writes TIMESTAMP
+			// columns in UTC too
+			Loc:    time.UTC,
+			Params: map[string]string{"time_zone": "'+00:00'"},
+		}
+		storage = NewMySQLStorage(cfg)
+	case "sqlite":
+		storage = NewSQLiteStorage(Envs.SQLitePath)
+	default:
+		log.Fatalf("unsupported DB_DRIVER %q, expected mysql or sqlite", Envs.DBDriver)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		m, err := storage.Migrator()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := runMigrateCommand(m, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// migrations run without the serving settings, such as the JWT keys
+	if err := validateConfig(Envs); err != nil {
+		log.Fatal(err)
+	}
+
+	if Envs.JWTKeysDir != "" {
+		keys, err := LoadKeySet(Envs.JWTKeysDir, Envs.JWTSigningKeyID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		signingKeys = keys
+	}
 
-	db, err := sqlStorage.Init()
+	db, err := storage.Init()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	store := NewStore(db)
+	var store Store = NewStore(db)
+	var searcher Searcher
+
+	if Envs.DBDriver == "mysql" {
+		searcher = NewSQLSearcher(db)
+	} else {
+		docs, err := NewStore(db).SearchDocuments(0)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		index := NewSearchIndex()
+		for _, d := range docs {
+			index.Add(d)
+		}
+
+		store = NewIndexedStore(store, index)
+		searcher = index
+	}
+
+	mailer, err := NewMailer(Envs)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	server := NewAPIServer(":8080", store)
+	server := NewAPIServer(":8080", store, searcher, mailer)
 	server.Serve()
-}
\ No newline at end of file
+}
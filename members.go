@@ -0,0 +1,278 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	RoleOwner      = "owner"
+	RoleMaintainer = "maintainer"
+	RoleMember     = "member"
+	RoleViewer     = "viewer"
+)
+
+// roleRanks orders the roles, each role can do everything the lower ones can.
+var roleRanks = map[string]int{
+	RoleViewer:     1,
+	RoleMember:     2,
+	RoleMaintainer: 3,
+	RoleOwner:      4,
+}
+
+func hasRole(role, minRole string) bool {
+	return roleRanks[role] >= roleRanks[minRole]
+}
+
+// authorizeProject checks that the caller is a member of the project with at
+// least minRole and writes the error response otherwise. The returned bool
+// reports whether the handler may continue.
+func authorizeProject(store Store, w http.ResponseWriter, r *http.Request, projectID int64, minRole string) (*ProjectMember, bool) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		permissionDenied(w)
+		return nil, false
+	}
+
+	member, err := store.GetProjectMember(projectID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		forbidden(w)
+		return nil, false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while checking project membership"})
+		return nil, false
+	}
+
+	if !hasRole(member.Role, minRole) {
+		forbidden(w)
+		return nil, false
+	}
+
+	return member, true
+}
+
+func (s *ProjectService) handleGetProjectMembers(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := s.store.GetProjectMembers(project.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing members"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, members)
+}
+
+func (s *ProjectService) handleAddProjectMember(w http.ResponseWriter, r *http.Request) {
+	project, caller, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *AddProjectMemberPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if payload.UserID == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errUserIDRequired.Error()})
+		return
+	}
+
+	if err := validateRole(payload.Role); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// only owners may hand out ownership
+	if payload.Role == RoleOwner && caller.Role != RoleOwner {
+		forbidden(w)
+		return
+	}
+
+	_, err = s.store.GetUserByID(strconv.FormatInt(payload.UserID, 10))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while adding the member"})
+		return
+	}
+
+	if _, err := s.store.GetProjectMember(project.ID, payload.UserID); err == nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: "user is already a member of the project"})
+		return
+	}
+
+	member, err := s.store.AddProjectMember(project.ID, payload.UserID, payload.Role)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while adding the member"})
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, member)
+}
+
+func (s *ProjectService) handleUpdateProjectMember(w http.ResponseWriter, r *http.Request) {
+	project, caller, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	member, ok := s.loadMember(w, r, project.ID)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *UpdateProjectMemberPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if err := validateRole(payload.Role); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// maintainers cannot promote to, or demote from, owner
+	if (payload.Role == RoleOwner || member.Role == RoleOwner) && caller.Role != RoleOwner {
+		forbidden(w)
+		return
+	}
+
+	if member.Role == RoleOwner && payload.Role != RoleOwner {
+		if ok := s.ensureAnotherOwner(w, project.ID); !ok {
+			return
+		}
+	}
+
+	if err := s.store.UpdateProjectMemberRole(project.ID, member.UserID, payload.Role); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while updating the member"})
+		return
+	}
+
+	member.Role = payload.Role
+	WriteJSON(w, http.StatusOK, member)
+}
+
+func (s *ProjectService) handleRemoveProjectMember(w http.ResponseWriter, r *http.Request) {
+	project, caller, ok := s.loadProject(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	member, ok := s.loadMember(w, r, project.ID)
+	if !ok {
+		return
+	}
+
+	// members may always leave a project, removing others needs a maintainer
+	// and removing an owner needs an owner
+	if member.UserID != caller.UserID {
+		minRole := RoleMaintainer
+		if member.Role == RoleOwner {
+			minRole = RoleOwner
+		}
+		if !hasRole(caller.Role, minRole) {
+			forbidden(w)
+			return
+		}
+	}
+
+	if member.Role == RoleOwner {
+		if ok := s.ensureAnotherOwner(w, project.ID); !ok {
+			return
+		}
+	}
+
+	if err := s.store.RemoveProjectMember(project.ID, member.UserID); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while removing the member"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *ProjectService) loadMember(w http.ResponseWriter, r *http.Request, projectID int64) (*ProjectMember, bool) {
+	userID, err := parseIDParam(mux.Vars(r)["userId"])
+	if err != nil || userID == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidID.Error()})
+		return nil, false
+	}
+
+	member, err := s.store.GetProjectMember(projectID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "member not found"})
+		return nil, false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the member"})
+		return nil, false
+	}
+
+	return member, true
+}
+
+// ensureAnotherOwner refuses to demote or remove the last owner of a project.
+func (s *ProjectService) ensureAnotherOwner(w http.ResponseWriter, projectID int64) bool {
+	members, err := s.store.GetProjectMembers(projectID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing members"})
+		return false
+	}
+
+	owners := 0
+	for _, m := range members {
+		if m.Role == RoleOwner {
+			owners++
+		}
+	}
+
+	if owners < 2 {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errLastOwner.Error()})
+		return false
+	}
+
+	return true
+}
+
+func validateRole(role string) error {
+	if role == "" {
+		return errRoleRequired
+	}
+
+	if _, ok := roleRanks[role]; !ok {
+		return errInvalidRole
+	}
+
+	return nil
+}
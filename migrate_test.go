@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigrator(t *testing.T) {
+	sqlStorage := NewSQLiteStorage(":memory:")
+	t.Cleanup(func() { sqlStorage.db.Close() })
+
+	m, err := sqlStorage.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should apply every migration", func(t *testing.T) {
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+
+		statuses, err := m.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, status := range statuses {
+			if !status.Applied {
+				t.Errorf("expected migration %d to be applied", status.Version)
+			}
+		}
+	})
+
+	t.Run("should be idempotent", func(t *testing.T) {
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should roll back and reapply", func(t *testing.T) {
+		if err := m.Down(len(m.migrations)); err != nil {
+			t.Fatal(err)
+		}
+
+		statuses, err := m.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, status := range statuses {
+			if status.Applied {
+				t.Errorf("expected migration %d to be rolled back", status.Version)
+			}
+		}
+
+		if err := m.Up(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should refuse modified migrations", func(t *testing.T) {
+		_, err := sqlStorage.db.Exec("UPDATE schema_migrations SET checksum = 'tampered' WHERE version = 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.Up(); !errors.Is(err, errMigrationModified) {
+			t.Errorf("expected %v, got %v", errMigrationModified, err)
+		}
+	})
+}
+
+func TestMigrateExistingProjects(t *testing.T) {
+	sqlStorage := NewSQLiteStorage(":memory:")
+	t.Cleanup(func() { sqlStorage.db.Close() })
+
+	// a database from before migrations, with the tables of the first one
+	initial, err := migrationFiles.ReadFile("migrations/sqlite/0001_create_initial_schema.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements := []string{
+		string(initial),
+		"INSERT INTO users (email, firstName, lastName, password) VALUES ('ada@example.com', 'Ada', 'Lovelace', 'hash'), ('grace@example.com', 'Grace', 'Hopper', 'hash')",
+		"INSERT INTO projects (name) VALUES ('Engine')",
+		"INSERT INTO tasks (name, projectId, assignedToId) VALUES ('Gears', 1, 2)",
+	}
+	for _, stmt := range statements {
+		for _, s := range strings.Split(stmt, ";\n") {
+			if _, err := sqlStorage.db.Exec(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	m, err := sqlStorage.Migrator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(sqlStorage.db)
+	member, err := store.GetProjectMember(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if member.Role != RoleMember {
+		t.Errorf("expected the assignee to be %s, got %s", RoleMember, member.Role)
+	}
+
+	// the owner is left for an operator to pick
+	if _, err := store.GetProjectMember(1, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no membership for an unrelated user, got %v", err)
+	}
+}
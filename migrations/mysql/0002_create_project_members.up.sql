@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS project_members (
+	projectId INT UNSIGNED NOT NULL,
+	userId INT UNSIGNED NOT NULL,
+	role ENUM('owner', 'maintainer', 'member', 'viewer') NOT NULL DEFAULT 'member',
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (projectId, userId),
+	INDEX idx_project_members_user (userId, projectId),
+	FOREIGN KEY (projectId) REFERENCES projects(id) ON DELETE CASCADE,
+	FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
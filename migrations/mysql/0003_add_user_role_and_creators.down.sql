@@ -0,0 +1,3 @@
+ALTER TABLE tasks DROP FOREIGN KEY fk_tasks_created_by, DROP COLUMN createdById;
+ALTER TABLE projects DROP FOREIGN KEY fk_projects_created_by, DROP COLUMN createdById;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN role ENUM('user', 'admin') NOT NULL DEFAULT 'user';
+
+ALTER TABLE projects
+	ADD COLUMN createdById INT UNSIGNED NULL,
+	ADD CONSTRAINT fk_projects_created_by FOREIGN KEY (createdById) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE tasks
+	ADD COLUMN createdById INT UNSIGNED NULL,
+	ADD CONSTRAINT fk_tasks_created_by FOREIGN KEY (createdById) REFERENCES users(id) ON DELETE SET NULL;
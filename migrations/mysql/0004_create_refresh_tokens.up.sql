@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id CHAR(32) NOT NULL,
+	userId INT UNSIGNED NOT NULL,
+	familyId CHAR(32) NOT NULL,
+	tokenHash CHAR(64) NOT NULL,
+	expiresAt DATETIME NOT NULL,
+	usedAt DATETIME NULL,
+	revokedAt DATETIME NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (id),
+	UNIQUE KEY (tokenHash),
+	INDEX idx_refresh_tokens_family (familyId),
+	FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN tokensRevokedAt;
+DROP TABLE IF EXISTS revoked_tokens;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	tokenId CHAR(32) NOT NULL,
+	expiresAt DATETIME NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (tokenId),
+	INDEX idx_revoked_tokens_expires (expiresAt)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+ALTER TABLE users ADD COLUMN tokensRevokedAt DATETIME NULL;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS comments (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+	taskId INT UNSIGNED NOT NULL,
+	authorId INT UNSIGNED NULL,
+	body TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updatedAt DATETIME NULL,
+
+	PRIMARY KEY (id),
+	INDEX idx_comments_task (taskId, id),
+	FOREIGN KEY (taskId) REFERENCES tasks(id) ON DELETE CASCADE,
+	FOREIGN KEY (authorId) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
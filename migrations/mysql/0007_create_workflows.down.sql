@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS workflow_transitions;
+DROP TABLE IF EXISTS workflow_states;
+UPDATE tasks SET status = 'TODO' WHERE status NOT IN ('TODO', 'IN_PROGRESS', 'IN_TESTING', 'DONE');
+ALTER TABLE tasks MODIFY status ENUM('TODO', 'IN_PROGRESS', 'IN_TESTING', 'DONE') NOT NULL DEFAULT 'TODO';
@@ -0,0 +1,22 @@
+ALTER TABLE tasks MODIFY status VARCHAR(64) NOT NULL DEFAULT 'TODO';
+
+CREATE TABLE IF NOT EXISTS workflow_states (
+	projectId INT UNSIGNED NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	position INT UNSIGNED NOT NULL,
+	isInitial BOOLEAN NOT NULL DEFAULT FALSE,
+	isTerminal BOOLEAN NOT NULL DEFAULT FALSE,
+
+	PRIMARY KEY (projectId, name),
+	FOREIGN KEY (projectId) REFERENCES projects(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS workflow_transitions (
+	projectId INT UNSIGNED NOT NULL,
+	fromState VARCHAR(64) NOT NULL,
+	toState VARCHAR(64) NOT NULL,
+
+	PRIMARY KEY (projectId, fromState, toState),
+	FOREIGN KEY (projectId, fromState) REFERENCES workflow_states(projectId, name) ON DELETE CASCADE,
+	FOREIGN KEY (projectId, toState) REFERENCES workflow_states(projectId, name) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
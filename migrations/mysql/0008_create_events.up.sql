@@ -0,0 +1,17 @@
+-- events is an append-only audit trail. It has no foreign keys on projects
+-- and tasks so the history outlives the rows it describes.
+CREATE TABLE IF NOT EXISTS events (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+	projectId INT UNSIGNED NOT NULL,
+	taskId INT UNSIGNED NULL,
+	actorId INT UNSIGNED NULL,
+	entityType VARCHAR(16) NOT NULL,
+	action VARCHAR(16) NOT NULL,
+	changes TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (id),
+	INDEX idx_events_project (projectId, id),
+	INDEX idx_events_task (taskId, id),
+	FOREIGN KEY (actorId) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+-- version is bumped on every update and exposed as the task ETag.
+ALTER TABLE tasks ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1;
@@ -0,0 +1,10 @@
+DROP INDEX idx_tasks_due ON tasks;
+DROP INDEX idx_tasks_priority ON tasks;
+
+ALTER TABLE tasks
+	DROP COLUMN timeSpentMinutes,
+	DROP COLUMN estimate,
+	DROP COLUMN dueDate,
+	DROP COLUMN startDate,
+	DROP COLUMN priority,
+	DROP COLUMN description;
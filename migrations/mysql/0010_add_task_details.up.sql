@@ -0,0 +1,11 @@
+-- priority is stored as a rank (1 LOW to 4 URGENT) so it sorts by urgency.
+ALTER TABLE tasks
+	ADD COLUMN description TEXT NULL,
+	ADD COLUMN priority TINYINT UNSIGNED NOT NULL DEFAULT 2,
+	ADD COLUMN startDate DATETIME NULL,
+	ADD COLUMN dueDate DATETIME NULL,
+	ADD COLUMN estimate INT UNSIGNED NULL,
+	ADD COLUMN timeSpentMinutes INT UNSIGNED NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_tasks_priority ON tasks (priority, id);
+CREATE INDEX idx_tasks_due ON tasks (dueDate, id);
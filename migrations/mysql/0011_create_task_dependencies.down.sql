@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS task_dependencies;
+
+ALTER TABLE tasks
+	DROP FOREIGN KEY fk_tasks_parent,
+	DROP COLUMN parentId;
@@ -0,0 +1,15 @@
+ALTER TABLE tasks
+	ADD COLUMN parentId INT UNSIGNED NULL,
+	ADD CONSTRAINT fk_tasks_parent FOREIGN KEY (parentId) REFERENCES tasks(id) ON DELETE SET NULL;
+
+-- blockerId blocks blockedId, the application keeps the graph acyclic.
+CREATE TABLE IF NOT EXISTS task_dependencies (
+	blockerId INT UNSIGNED NOT NULL,
+	blockedId INT UNSIGNED NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (blockerId, blockedId),
+	INDEX idx_task_dependencies_blocked (blockedId),
+	FOREIGN KEY (blockerId) REFERENCES tasks(id) ON DELETE CASCADE,
+	FOREIGN KEY (blockedId) REFERENCES tasks(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
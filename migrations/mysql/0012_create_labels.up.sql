@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS labels (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+	projectId INT UNSIGNED NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	color CHAR(7) NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (id),
+	UNIQUE KEY uq_labels_project_name (projectId, name),
+	FOREIGN KEY (projectId) REFERENCES projects(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS task_labels (
+	taskId INT UNSIGNED NOT NULL,
+	labelId INT UNSIGNED NOT NULL,
+
+	PRIMARY KEY (taskId, labelId),
+	INDEX idx_task_labels_label (labelId),
+	FOREIGN KEY (taskId) REFERENCES tasks(id) ON DELETE CASCADE,
+	FOREIGN KEY (labelId) REFERENCES labels(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+DROP INDEX ft_comments_body ON comments;
+DROP INDEX ft_projects_name ON projects;
+DROP INDEX ft_tasks_text ON tasks;
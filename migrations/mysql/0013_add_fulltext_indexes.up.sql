@@ -0,0 +1,3 @@
+ALTER TABLE tasks ADD FULLTEXT INDEX ft_tasks_text (name, description);
+ALTER TABLE projects ADD FULLTEXT INDEX ft_projects_name (name);
+ALTER TABLE comments ADD FULLTEXT INDEX ft_comments_body (body);
@@ -0,0 +1,7 @@
+ALTER TABLE projects DROP INDEX ft_projects_text, ADD FULLTEXT INDEX ft_projects_name (name);
+
+ALTER TABLE projects
+	DROP FOREIGN KEY fk_projects_owner,
+	DROP COLUMN ownerId,
+	DROP COLUMN archivedAt,
+	DROP COLUMN description;
@@ -0,0 +1,10 @@
+-- archived projects are hidden and their tasks read-only until restored.
+ALTER TABLE projects
+	ADD COLUMN description TEXT NULL,
+	ADD COLUMN ownerId INT UNSIGNED NULL,
+	ADD COLUMN archivedAt DATETIME NULL,
+	ADD CONSTRAINT fk_projects_owner FOREIGN KEY (ownerId) REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE projects SET ownerId = createdById;
+
+ALTER TABLE projects DROP INDEX ft_projects_name, ADD FULLTEXT INDEX ft_projects_text (name, description);
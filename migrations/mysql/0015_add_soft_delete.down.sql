@@ -0,0 +1,11 @@
+ALTER TABLE tasks
+	DROP FOREIGN KEY fk_tasks_deleted_by,
+	DROP INDEX idx_tasks_deleted,
+	DROP COLUMN deletedById,
+	DROP COLUMN deletedAt;
+
+ALTER TABLE projects
+	DROP FOREIGN KEY fk_projects_deleted_by,
+	DROP INDEX idx_projects_deleted,
+	DROP COLUMN deletedById,
+	DROP COLUMN deletedAt;
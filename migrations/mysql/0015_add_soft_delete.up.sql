@@ -0,0 +1,13 @@
+-- deleted tasks and projects stay in the trash until the purge job removes
+-- them, see trash.go.
+ALTER TABLE projects
+	ADD COLUMN deletedAt DATETIME NULL,
+	ADD COLUMN deletedById INT UNSIGNED NULL,
+	ADD INDEX idx_projects_deleted (deletedAt),
+	ADD CONSTRAINT fk_projects_deleted_by FOREIGN KEY (deletedById) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE tasks
+	ADD COLUMN deletedAt DATETIME NULL,
+	ADD COLUMN deletedById INT UNSIGNED NULL,
+	ADD INDEX idx_tasks_deleted (deletedAt),
+	ADD CONSTRAINT fk_tasks_deleted_by FOREIGN KEY (deletedById) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,19 @@
+-- users that signed up before email verification existed keep their access.
+ALTER TABLE users ADD COLUMN emailVerifiedAt DATETIME NULL;
+
+UPDATE users SET emailVerifiedAt = createdAt;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+	userId INT UNSIGNED NOT NULL,
+	purpose VARCHAR(32) NOT NULL,
+	tokenHash CHAR(64) NOT NULL,
+	expiresAt DATETIME NOT NULL,
+	usedAt DATETIME NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (id),
+	UNIQUE KEY (tokenHash),
+	INDEX idx_user_tokens_user (userId, purpose),
+	FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -0,0 +1,30 @@
+-- login_failures counts the recent failed logins of an account, keyed by
+-- email so unknown emails are throttled the same way, and of a client IP.
+CREATE TABLE IF NOT EXISTS login_failures (
+	kind VARCHAR(16) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	failures INT UNSIGNED NOT NULL DEFAULT 0,
+	lastFailureAt DATETIME NOT NULL,
+	lockedUntil DATETIME NULL,
+
+	PRIMARY KEY (kind, subject)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- lockouts is the history of lockouts for administrators to review.
+CREATE TABLE IF NOT EXISTS lockouts (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+	kind VARCHAR(16) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	userId INT UNSIGNED NULL,
+	ip VARCHAR(45) NOT NULL,
+	failures INT UNSIGNED NOT NULL,
+	lockedUntil DATETIME NOT NULL,
+	clearedAt DATETIME NULL,
+	clearedById INT UNSIGNED NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (id),
+	INDEX idx_lockouts_subject (kind, subject),
+	FOREIGN KEY (userId) REFERENCES users(id) ON DELETE SET NULL,
+	FOREIGN KEY (clearedById) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
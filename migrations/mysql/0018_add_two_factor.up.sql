@@ -0,0 +1,18 @@
+-- totpSecret is set when enrollment starts and totpEnabledAt once the first
+-- code is confirmed. totpLastStep stops a code from being used twice.
+ALTER TABLE users
+	ADD COLUMN totpSecret VARCHAR(64) NULL,
+	ADD COLUMN totpEnabledAt DATETIME NULL,
+	ADD COLUMN totpLastStep BIGINT NULL;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+	userId INT UNSIGNED NOT NULL,
+	codeHash CHAR(64) NOT NULL,
+	usedAt DATETIME NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (id),
+	INDEX idx_recovery_codes_user (userId, codeHash),
+	FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
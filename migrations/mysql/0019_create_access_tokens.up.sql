@@ -0,0 +1,19 @@
+-- personal access tokens for scripts and CI. scopes is a space separated
+-- list, see access_tokens.go.
+CREATE TABLE IF NOT EXISTS access_tokens (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+	userId INT UNSIGNED NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	prefix VARCHAR(16) NOT NULL,
+	tokenHash CHAR(64) NOT NULL,
+	scopes VARCHAR(255) NOT NULL,
+	expiresAt DATETIME NULL,
+	lastUsedAt DATETIME NULL,
+	revokedAt DATETIME NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (id),
+	UNIQUE KEY (tokenHash),
+	INDEX idx_access_tokens_user (userId),
+	FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
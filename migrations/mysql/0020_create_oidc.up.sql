@@ -0,0 +1,26 @@
+-- oidc_logins are the pending single sign-on logins, from the redirect to the
+-- identity provider until its callback. They live for minutes.
+CREATE TABLE IF NOT EXISTS oidc_logins (
+	stateHash CHAR(64) NOT NULL,
+	nonce VARCHAR(64) NOT NULL,
+	codeVerifier VARCHAR(128) NOT NULL,
+	expiresAt DATETIME NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (stateHash)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- user_identities links users to their account at an identity provider.
+CREATE TABLE IF NOT EXISTS user_identities (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+	userId INT UNSIGNED NOT NULL,
+	issuer VARCHAR(255) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (id),
+	UNIQUE KEY uq_user_identities_subject (issuer, subject),
+	INDEX idx_user_identities_user (userId),
+	FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
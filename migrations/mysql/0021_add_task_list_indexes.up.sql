@@ -0,0 +1,27 @@
+-- 0001 declares these indexes inline, but databases that had the tables
+-- before migrations existed skipped its CREATE TABLE IF NOT EXISTS. MySQL has
+-- no CREATE INDEX IF NOT EXISTS, so each index is created only when missing.
+SET @stmt = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'tasks' AND index_name = 'idx_tasks_created') = 0, 'CREATE INDEX idx_tasks_created ON tasks (createdAt, id)', 'DO 0');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'tasks' AND index_name = 'idx_tasks_name') = 0, 'CREATE INDEX idx_tasks_name ON tasks (name, id)', 'DO 0');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'tasks' AND index_name = 'idx_tasks_status_created') = 0, 'CREATE INDEX idx_tasks_status_created ON tasks (status, createdAt, id)', 'DO 0');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'tasks' AND index_name = 'idx_tasks_project_created') = 0, 'CREATE INDEX idx_tasks_project_created ON tasks (projectId, createdAt, id)', 'DO 0');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @stmt = IF((SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'tasks' AND index_name = 'idx_tasks_assigned_created') = 0, 'CREATE INDEX idx_tasks_assigned_created ON tasks (assignedToId, createdAt, id)', 'DO 0');
+PREPARE stmt FROM @stmt;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
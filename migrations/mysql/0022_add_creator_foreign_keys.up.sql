@@ -0,0 +1,3 @@
+-- MySQL has had these foreign keys since 0003, 0014 and 0015, the SQLite
+-- migration of the same version adds them there.
+DO 0;
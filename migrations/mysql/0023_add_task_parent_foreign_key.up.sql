@@ -0,0 +1,3 @@
+-- MySQL has had this foreign key since 0011, the SQLite migration of the
+-- same version adds it there.
+DO 0;
@@ -0,0 +1,2 @@
+-- the memberships may have changed since, rolling back keeps them.
+DO 0;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL UNIQUE,
+	firstName TEXT NOT NULL,
+	lastName TEXT NOT NULL,
+	password TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS projects (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tasks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'TODO' CHECK (status IN ('TODO', 'IN_PROGRESS', 'IN_TESTING', 'DONE')),
+	projectId INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	assignedToId INTEGER NOT NULL REFERENCES users(id),
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_created ON tasks (createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_name ON tasks (name, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status_created ON tasks (status, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_project_created ON tasks (projectId, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_assigned_created ON tasks (assignedToId, createdAt, id);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS project_members (
+	projectId INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'maintainer', 'member', 'viewer')),
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (projectId, userId)
+);
+
+CREATE INDEX IF NOT EXISTS idx_project_members_user ON project_members (userId, projectId);
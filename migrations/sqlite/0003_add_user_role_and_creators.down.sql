@@ -0,0 +1,3 @@
+ALTER TABLE tasks DROP COLUMN createdById;
+ALTER TABLE projects DROP COLUMN createdById;
+ALTER TABLE users DROP COLUMN role;
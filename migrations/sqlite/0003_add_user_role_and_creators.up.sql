@@ -0,0 +1,5 @@
+-- SQLite cannot drop columns that take part in constraints, so columns added
+-- after the initial schema are validated by the application instead.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE projects ADD COLUMN createdById INTEGER;
+ALTER TABLE tasks ADD COLUMN createdById INTEGER;
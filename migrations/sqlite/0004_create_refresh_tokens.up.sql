@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id TEXT PRIMARY KEY,
+	userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	familyId TEXT NOT NULL,
+	tokenHash TEXT NOT NULL UNIQUE,
+	expiresAt DATETIME NOT NULL,
+	usedAt DATETIME,
+	revokedAt DATETIME,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens (familyId);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	tokenId TEXT PRIMARY KEY,
+	expiresAt DATETIME NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens (expiresAt);
+
+ALTER TABLE users ADD COLUMN tokensRevokedAt DATETIME;
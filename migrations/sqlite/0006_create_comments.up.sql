@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	taskId INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	authorId INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	body TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updatedAt DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_task ON comments (taskId, id);
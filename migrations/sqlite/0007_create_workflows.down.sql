@@ -0,0 +1,25 @@
+DROP TABLE IF EXISTS workflow_transitions;
+DROP TABLE IF EXISTS workflow_states;
+
+CREATE TABLE tasks_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'TODO' CHECK (status IN ('TODO', 'IN_PROGRESS', 'IN_TESTING', 'DONE')),
+	projectId INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	assignedToId INTEGER NOT NULL REFERENCES users(id),
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	createdById INTEGER
+);
+
+INSERT INTO tasks_old (id, name, status, projectId, assignedToId, createdAt, createdById)
+	SELECT id, name, CASE WHEN status IN ('TODO', 'IN_PROGRESS', 'IN_TESTING', 'DONE') THEN status ELSE 'TODO' END, projectId, assignedToId, createdAt, createdById FROM tasks;
+
+DROP TABLE tasks;
+
+ALTER TABLE tasks_old RENAME TO tasks;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_created ON tasks (createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_name ON tasks (name, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status_created ON tasks (status, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_project_created ON tasks (projectId, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_assigned_created ON tasks (assignedToId, createdAt, id);
@@ -0,0 +1,44 @@
+-- SQLite cannot drop the status CHECK constraint in place, so the tasks
+-- table is rebuilt without it.
+CREATE TABLE tasks_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'TODO',
+	projectId INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	assignedToId INTEGER NOT NULL REFERENCES users(id),
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	createdById INTEGER
+);
+
+INSERT INTO tasks_new (id, name, status, projectId, assignedToId, createdAt, createdById)
+	SELECT id, name, status, projectId, assignedToId, createdAt, createdById FROM tasks;
+
+DROP TABLE tasks;
+
+ALTER TABLE tasks_new RENAME TO tasks;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_created ON tasks (createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_name ON tasks (name, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status_created ON tasks (status, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_project_created ON tasks (projectId, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_assigned_created ON tasks (assignedToId, createdAt, id);
+
+CREATE TABLE IF NOT EXISTS workflow_states (
+	projectId INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	isInitial BOOLEAN NOT NULL DEFAULT FALSE,
+	isTerminal BOOLEAN NOT NULL DEFAULT FALSE,
+
+	PRIMARY KEY (projectId, name)
+);
+
+CREATE TABLE IF NOT EXISTS workflow_transitions (
+	projectId INTEGER NOT NULL,
+	fromState TEXT NOT NULL,
+	toState TEXT NOT NULL,
+
+	PRIMARY KEY (projectId, fromState, toState),
+	FOREIGN KEY (projectId, fromState) REFERENCES workflow_states(projectId, name) ON DELETE CASCADE,
+	FOREIGN KEY (projectId, toState) REFERENCES workflow_states(projectId, name) ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+-- events is an append-only audit trail. It has no foreign keys on projects
+-- and tasks so the history outlives the rows it describes.
+CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	projectId INTEGER NOT NULL,
+	taskId INTEGER,
+	actorId INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	entityType TEXT NOT NULL,
+	action TEXT NOT NULL,
+	changes TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_events_project ON events (projectId, id);
+CREATE INDEX IF NOT EXISTS idx_events_task ON events (taskId, id);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_tasks_due;
+DROP INDEX IF EXISTS idx_tasks_priority;
+
+ALTER TABLE tasks DROP COLUMN timeSpentMinutes;
+ALTER TABLE tasks DROP COLUMN estimate;
+ALTER TABLE tasks DROP COLUMN dueDate;
+ALTER TABLE tasks DROP COLUMN startDate;
+ALTER TABLE tasks DROP COLUMN priority;
+ALTER TABLE tasks DROP COLUMN description;
@@ -0,0 +1,10 @@
+-- priority is stored as a rank (1 LOW to 4 URGENT) so it sorts by urgency.
+ALTER TABLE tasks ADD COLUMN description TEXT;
+ALTER TABLE tasks ADD COLUMN priority INTEGER NOT NULL DEFAULT 2;
+ALTER TABLE tasks ADD COLUMN startDate DATETIME;
+ALTER TABLE tasks ADD COLUMN dueDate DATETIME;
+ALTER TABLE tasks ADD COLUMN estimate INTEGER;
+ALTER TABLE tasks ADD COLUMN timeSpentMinutes INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_priority ON tasks (priority, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_due ON tasks (dueDate, id);
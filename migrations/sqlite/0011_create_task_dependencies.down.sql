@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS task_dependencies;
+
+DROP INDEX IF EXISTS idx_tasks_parent;
+
+ALTER TABLE tasks DROP COLUMN parentId;
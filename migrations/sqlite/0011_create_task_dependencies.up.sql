@@ -0,0 +1,16 @@
+-- parentId has no foreign key so the column can be dropped again, deleting a
+-- task clears the parentId of its subtasks instead.
+ALTER TABLE tasks ADD COLUMN parentId INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks (parentId);
+
+-- blockerId blocks blockedId, the application keeps the graph acyclic.
+CREATE TABLE IF NOT EXISTS task_dependencies (
+	blockerId INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	blockedId INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	PRIMARY KEY (blockerId, blockedId)
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_dependencies_blocked ON task_dependencies (blockedId);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS labels (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	projectId INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	color TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	UNIQUE (projectId, name)
+);
+
+CREATE TABLE IF NOT EXISTS task_labels (
+	taskId INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+	labelId INTEGER NOT NULL REFERENCES labels(id) ON DELETE CASCADE,
+
+	PRIMARY KEY (taskId, labelId)
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_labels_label ON task_labels (labelId);
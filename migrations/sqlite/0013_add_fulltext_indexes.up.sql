@@ -0,0 +1 @@
+-- SQLite is searched with the in-process index, see search_index.go.
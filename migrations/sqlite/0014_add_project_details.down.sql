@@ -0,0 +1,3 @@
+ALTER TABLE projects DROP COLUMN archivedAt;
+ALTER TABLE projects DROP COLUMN ownerId;
+ALTER TABLE projects DROP COLUMN description;
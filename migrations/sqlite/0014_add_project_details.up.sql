@@ -0,0 +1,6 @@
+-- archived projects are hidden and their tasks read-only until restored.
+ALTER TABLE projects ADD COLUMN description TEXT;
+ALTER TABLE projects ADD COLUMN ownerId INTEGER;
+ALTER TABLE projects ADD COLUMN archivedAt DATETIME;
+
+UPDATE projects SET ownerId = createdById;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_tasks_deleted;
+DROP INDEX IF EXISTS idx_projects_deleted;
+
+ALTER TABLE tasks DROP COLUMN deletedById;
+ALTER TABLE tasks DROP COLUMN deletedAt;
+ALTER TABLE projects DROP COLUMN deletedById;
+ALTER TABLE projects DROP COLUMN deletedAt;
@@ -0,0 +1,9 @@
+-- deleted tasks and projects stay in the trash until the purge job removes
+-- them, see trash.go.
+ALTER TABLE projects ADD COLUMN deletedAt DATETIME;
+ALTER TABLE projects ADD COLUMN deletedById INTEGER;
+ALTER TABLE tasks ADD COLUMN deletedAt DATETIME;
+ALTER TABLE tasks ADD COLUMN deletedById INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_projects_deleted ON projects (deletedAt);
+CREATE INDEX IF NOT EXISTS idx_tasks_deleted ON tasks (deletedAt);
@@ -0,0 +1,16 @@
+-- users that signed up before email verification existed keep their access.
+ALTER TABLE users ADD COLUMN emailVerifiedAt DATETIME;
+
+UPDATE users SET emailVerifiedAt = createdAt;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	purpose TEXT NOT NULL,
+	tokenHash TEXT NOT NULL UNIQUE,
+	expiresAt DATETIME NOT NULL,
+	usedAt DATETIME,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user ON user_tokens (userId, purpose);
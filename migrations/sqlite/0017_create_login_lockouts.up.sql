@@ -0,0 +1,26 @@
+-- login_failures counts the recent failed logins of an account, keyed by
+-- email so unknown emails are throttled the same way, and of a client IP.
+CREATE TABLE IF NOT EXISTS login_failures (
+	kind TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	failures INTEGER NOT NULL DEFAULT 0,
+	lastFailureAt DATETIME NOT NULL,
+	lockedUntil DATETIME,
+	PRIMARY KEY (kind, subject)
+);
+
+-- lockouts is the history of lockouts for administrators to review.
+CREATE TABLE IF NOT EXISTS lockouts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	kind TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	userId INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	ip TEXT NOT NULL,
+	failures INTEGER NOT NULL,
+	lockedUntil DATETIME NOT NULL,
+	clearedAt DATETIME,
+	clearedById INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_lockouts_subject ON lockouts (kind, subject);
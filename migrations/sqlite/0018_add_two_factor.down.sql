@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recovery_codes;
+
+ALTER TABLE users DROP COLUMN totpLastStep;
+ALTER TABLE users DROP COLUMN totpEnabledAt;
+ALTER TABLE users DROP COLUMN totpSecret;
@@ -0,0 +1,15 @@
+-- totpSecret is set when enrollment starts and totpEnabledAt once the first
+-- code is confirmed. totpLastStep stops a code from being used twice.
+ALTER TABLE users ADD COLUMN totpSecret TEXT;
+ALTER TABLE users ADD COLUMN totpEnabledAt DATETIME;
+ALTER TABLE users ADD COLUMN totpLastStep INTEGER;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	codeHash TEXT NOT NULL,
+	usedAt DATETIME,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes (userId, codeHash);
@@ -0,0 +1,16 @@
+-- personal access tokens for scripts and CI. scopes is a space separated
+-- list, see access_tokens.go.
+CREATE TABLE IF NOT EXISTS access_tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	tokenHash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	expiresAt DATETIME,
+	lastUsedAt DATETIME,
+	revokedAt DATETIME,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_tokens_user ON access_tokens (userId);
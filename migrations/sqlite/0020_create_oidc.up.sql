@@ -0,0 +1,22 @@
+-- oidc_logins are the pending single sign-on logins, from the redirect to the
+-- identity provider until its callback. They live for minutes.
+CREATE TABLE IF NOT EXISTS oidc_logins (
+	stateHash TEXT PRIMARY KEY,
+	nonce TEXT NOT NULL,
+	codeVerifier TEXT NOT NULL,
+	expiresAt DATETIME NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- user_identities links users to their account at an identity provider.
+CREATE TABLE IF NOT EXISTS user_identities (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	userId INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	issuer TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities (userId);
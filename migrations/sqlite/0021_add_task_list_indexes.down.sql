@@ -0,0 +1,2 @@
+-- the indexes belong to the schema of 0001, rolling back leaves them in place.
+SELECT 1;
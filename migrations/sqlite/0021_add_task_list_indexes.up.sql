@@ -0,0 +1,7 @@
+-- SQLite databases always got these indexes from 0001, this keeps the
+-- version numbers of both dialects in step with the MySQL migration.
+CREATE INDEX IF NOT EXISTS idx_tasks_created ON tasks (createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_name ON tasks (name, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status_created ON tasks (status, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_project_created ON tasks (projectId, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_assigned_created ON tasks (assignedToId, createdAt, id);
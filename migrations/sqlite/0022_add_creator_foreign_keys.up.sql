@@ -0,0 +1,62 @@
+-- SQLite cannot add a foreign key with ALTER TABLE, so the user columns
+-- added after the initial schema had none and deleting a user had to clear
+-- them by hand. The tables are rebuilt with the foreign keys MySQL has had
+-- since those columns were added. Ids of users that no longer exist are
+-- cleared on the way.
+CREATE TABLE projects_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	createdById INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	description TEXT,
+	ownerId INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	archivedAt DATETIME,
+	deletedAt DATETIME,
+	deletedById INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+INSERT INTO projects_new (id, name, createdAt, createdById, description, ownerId, archivedAt, deletedAt, deletedById)
+	SELECT id, name, createdAt, CASE WHEN createdById IN (SELECT id FROM users) THEN createdById END, description, CASE WHEN ownerId IN (SELECT id FROM users) THEN ownerId END, archivedAt, deletedAt, CASE WHEN deletedById IN (SELECT id FROM users) THEN deletedById END FROM projects;
+
+DROP TABLE projects;
+
+ALTER TABLE projects_new RENAME TO projects;
+
+CREATE INDEX IF NOT EXISTS idx_projects_deleted ON projects (deletedAt);
+
+CREATE TABLE tasks_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'TODO',
+	projectId INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	assignedToId INTEGER NOT NULL REFERENCES users(id),
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	createdById INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	description TEXT,
+	priority INTEGER NOT NULL DEFAULT 2,
+	startDate DATETIME,
+	dueDate DATETIME,
+	estimate INTEGER,
+	timeSpentMinutes INTEGER NOT NULL DEFAULT 0,
+	parentId INTEGER,
+	deletedAt DATETIME,
+	deletedById INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+INSERT INTO tasks_new (id, name, status, projectId, assignedToId, createdAt, createdById, version, description, priority, startDate, dueDate, estimate, timeSpentMinutes, parentId, deletedAt, deletedById)
+	SELECT id, name, status, projectId, assignedToId, createdAt, CASE WHEN createdById IN (SELECT id FROM users) THEN createdById END, version, description, priority, startDate, dueDate, estimate, timeSpentMinutes, parentId, deletedAt, CASE WHEN deletedById IN (SELECT id FROM users) THEN deletedById END FROM tasks;
+
+DROP TABLE tasks;
+
+ALTER TABLE tasks_new RENAME TO tasks;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_created ON tasks (createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_name ON tasks (name, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status_created ON tasks (status, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_project_created ON tasks (projectId, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_assigned_created ON tasks (assignedToId, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_priority ON tasks (priority, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_due ON tasks (dueDate, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks (parentId);
+CREATE INDEX IF NOT EXISTS idx_tasks_deleted ON tasks (deletedAt);
@@ -0,0 +1,36 @@
+CREATE TABLE tasks_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'TODO',
+	projectId INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+	assignedToId INTEGER NOT NULL REFERENCES users(id),
+	createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	createdById INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	description TEXT,
+	priority INTEGER NOT NULL DEFAULT 2,
+	startDate DATETIME,
+	dueDate DATETIME,
+	estimate INTEGER,
+	timeSpentMinutes INTEGER NOT NULL DEFAULT 0,
+	parentId INTEGER,
+	deletedAt DATETIME,
+	deletedById INTEGER REFERENCES users(id) ON DELETE SET NULL
+);
+
+INSERT INTO tasks_new (id, name, status, projectId, assignedToId, createdAt, createdById, version, description, priority, startDate, dueDate, estimate, timeSpentMinutes, parentId, deletedAt, deletedById)
+	SELECT id, name, status, projectId, assignedToId, createdAt, createdById, version, description, priority, startDate, dueDate, estimate, timeSpentMinutes, parentId, deletedAt, deletedById FROM tasks;
+
+DROP TABLE tasks;
+
+ALTER TABLE tasks_new RENAME TO tasks;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_created ON tasks (createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_name ON tasks (name, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_status_created ON tasks (status, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_project_created ON tasks (projectId, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_assigned_created ON tasks (assignedToId, createdAt, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_priority ON tasks (priority, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_due ON tasks (dueDate, id);
+CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks (parentId);
+CREATE INDEX IF NOT EXISTS idx_tasks_deleted ON tasks (deletedAt);
@@ -0,0 +1,9 @@
+-- Projects from before 0002 have no members, so nobody can open them. The
+-- users assigned to their tasks and the users who created those tasks become
+-- members. Nobody becomes owner here, pick the owner of each such project by
+-- hand: give that user the 'owner' role in project_members and set
+-- projects.ownerId to them. Until then nobody can manage its members.
+INSERT INTO project_members (projectId, userId, role)
+SELECT DISTINCT t.projectId, u.id, 'member'
+FROM tasks t JOIN users u ON u.id = t.assignedToId OR u.id = t.createdById
+WHERE t.projectId NOT IN (SELECT projectId FROM project_members);
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// oidcClockSkew is how far the clock of the identity provider may be off.
+	oidcClockSkew = time.Minute
+	// oidcKeysRefresh limits how often an unknown kid fetches the keys again.
+	oidcKeysRefresh = time.Minute
+	// oidcMaxResponse bounds what is read from the identity provider.
+	oidcMaxResponse = 1 << 20
+)
+
+// oidcDiscovery is the part of the discovery document the login needs.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider talks to an OpenID Connect identity provider with the
+// authorization code flow. The discovery document is fetched on first use,
+// and the keys again when an ID token is signed with a kid they lack.
+type OIDCProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+	client       *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*SigningKey
+	keysFetchedAt time.Time
+}
+
+func NewOIDCProvider(issuer, clientID, clientSecret, redirectURL, scopes string) *OIDCProvider {
+	return &OIDCProvider{
+		issuer:       issuer,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       scopes,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// NewOIDCProviderFromConfig redirects to the callback route of APP_URL unless
+// OIDC_REDIRECT_URL says otherwise.
+func NewOIDCProviderFromConfig(cfg Config) *OIDCProvider {
+	redirectURL := cfg.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(cfg.AppURL, "/") + "/api/v1/auth/oidc/callback"
+	}
+
+	return NewOIDCProvider(cfg.OIDCIssuer, cfg.OIDCClientID, cfg.OIDCClientSecret, redirectURL, cfg.OIDCScopes)
+}
+
+// AuthCodeURL is where the browser logs in. challenge is the S256 PKCE
+// challenge of the verifier later given to Exchange.
+func (p *OIDCProvider) AuthCodeURL(state, nonce, challenge string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", p.redirectURL)
+	q.Set("scope", p.scopes)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", challenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades the authorization code for the raw ID token.
+func (p *OIDCProvider) Exchange(code, verifier string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.clientID)
+
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// confidential clients authenticate with client_secret_basic, public
+	// clients rely on PKCE alone
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, oidcMaxResponse)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token endpoint: %s: %w", res.Status, err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint: %s: %s %s", res.Status, body.Error, body.ErrorDescription)
+	}
+
+	if body.IDToken == "" {
+		return "", errors.New("token endpoint: no id_token in the response")
+	}
+
+	return body.IDToken, nil
+}
+
+// VerifyIDToken checks the signature of the ID token against the keys of the
+// provider, and that it was issued by the provider for this client and this
+// login.
+func (p *OIDCProvider) VerifyIDToken(raw, nonce string) (*IDTokenClaims, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	parser := &jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "EdDSA"}}
+
+	if _, err := parser.ParseWithClaims(raw, claims, p.keyfunc); err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != d.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+
+	if !claims.Audience.contains(p.clientID) {
+		return nil, fmt.Errorf("token not issued for client %q", p.clientID)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID {
+		return nil, fmt.Errorf("unexpected authorized party %q", claims.AuthorizedParty)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("nonce mismatch")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("token without subject")
+	}
+
+	return claims, nil
+}
+
+func (p *OIDCProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	if err := p.getJSON(strings.TrimSuffix(p.issuer, "/")+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+
+	// the issuer is what ID tokens are checked against, so a document served
+	// for another issuer is refused
+	if d.Issuer != p.issuer {
+		return nil, fmt.Errorf("discovery document for issuer %q, expected %q", d.Issuer, p.issuer)
+	}
+
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("incomplete discovery document")
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// keyfunc finds the key of an ID token, fetching the keys again when the
+// provider rotated to a kid they lack.
+func (p *OIDCProvider) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := p.key(kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+func (p *OIDCProvider) key(kid string) (*SigningKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	find := func() *SigningKey {
+		// a provider with a single key may leave the kid out
+		if kid == "" && len(p.keys) == 1 {
+			for _, key := range p.keys {
+				return key
+			}
+		}
+		return p.keys[kid]
+	}
+
+	if key := find(); key != nil {
+		return key, nil
+	}
+
+	if p.keys != nil && time.Since(p.keysFetchedAt) < oidcKeysRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var jwks JWKS
+	if err := p.getJSON(p.discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*SigningKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// keys of unsupported types are skipped, the provider may publish
+		// more kinds than it signs ID tokens with
+		key, err := parseJWK(jwk)
+		if err != nil {
+			continue
+		}
+		keys[key.ID] = key
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key := find(); key != nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) getJSON(u string, dst any) error {
+	res, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, res.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, oidcMaxResponse)).Decode(dst)
+}
+
+// parseJWK reads the public RSA and Ed25519 keys of a JWKS, the kinds KeySet
+// publishes.
+func parseJWK(jwk *JWK) (*SigningKey, error) {
+	key := &SigningKey{ID: jwk.Kid}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errInvalidKey
+		}
+
+		key.Method = jwt.SigningMethodRS256
+		if jwk.Alg != "" {
+			method, ok := jwt.GetSigningMethod(jwk.Alg).(*jwt.SigningMethodRSA)
+			if !ok {
+				return nil, errInvalidKey
+			}
+			key.Method = method
+		}
+
+		key.Public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errInvalidKey
+		}
+
+		key.Method, key.Public = jwt.SigningMethodEdDSA, ed25519.PublicKey(x)
+	default:
+		return nil, errInvalidKey
+	}
+
+	return key, nil
+}
+
+// pkceChallenge is the S256 code challenge of a PKCE verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// IDTokenClaims are the claims of an ID token the login uses.
+type IDTokenClaims struct {
+	Issuer          string    `json:"iss"`
+	Subject         string    `json:"sub"`
+	Audience        audience  `json:"aud"`
+	AuthorizedParty string    `json:"azp,omitempty"`
+	ExpiresAt       int64     `json:"exp"`
+	IssuedAt        int64     `json:"iat"`
+	Nonce           string    `json:"nonce"`
+	Email           string    `json:"email,omitempty"`
+	EmailVerified   claimBool `json:"email_verified,omitempty"`
+	Name            string    `json:"name,omitempty"`
+	GivenName       string    `json:"given_name,omitempty"`
+	FamilyName      string    `json:"family_name,omitempty"`
+}
+
+// Valid checks the times of the token, the rest is up to VerifyIDToken.
+func (c *IDTokenClaims) Valid() error {
+	now := time.Now()
+
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(oidcClockSkew)) {
+		return errors.New("token is expired")
+	}
+
+	if time.Unix(c.IssuedAt, 0).After(now.Add(oidcClockSkew)) {
+		return errors.New("token used before issued")
+	}
+
+	return nil
+}
+
+// audience is the aud claim, which is a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, aud := range a {
+		if aud == s {
+			return true
+		}
+	}
+	return false
+}
+
+// claimBool is a boolean claim, which some providers send as the string
+// "true" or "false".
+type claimBool bool
+
+func (c *claimBool) UnmarshalJSON(b []byte) error {
+	switch string(b) {
+	case `true`, `"true"`:
+		*c = true
+	case `false`, `"false"`, `null`:
+		*c = false
+	default:
+		return fmt.Errorf("invalid boolean claim %s", b)
+	}
+
+	return nil
+}
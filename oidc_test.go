@@ -0,0 +1,357 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// testIdP is an identity provider that logs in whoever the test says, with
+// the checks of a real one on the PKCE verifier and the client.
+type testIdP struct {
+	*httptest.Server
+	keys *KeySet
+
+	mu    sync.Mutex
+	next  IDTokenClaims
+	codes map[string]testIdPCode
+}
+
+type testIdPCode struct {
+	challenge   string
+	redirectURI string
+	claims      IDTokenClaims
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := &SigningKey{ID: "idp-1", Method: jwt.SigningMethodRS256, Private: private, Public: &private.PublicKey}
+	idp := &testIdP{keys: &KeySet{signing: key, keys: map[string]*SigningKey{key.ID: key}}, codes: map[string]testIdPCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, &oidcDiscovery{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			JWKSURI:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, idp.keys.JWKS())
+	})
+	mux.HandleFunc("/authorize", idp.handleAuthorize)
+	mux.HandleFunc("/token", idp.handleToken)
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+func (idp *testIdP) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != "app" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	code, _ := newOpaqueToken()
+
+	idp.mu.Lock()
+	claims := idp.next
+	claims.Nonce = q.Get("nonce")
+	idp.codes[code] = testIdPCode{challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri"), claims: claims}
+	idp.mu.Unlock()
+
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+}
+
+func (idp *testIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != "app" || secret != "s3cret" {
+		WriteJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	code, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	idp.mu.Unlock()
+
+	if !ok || pkceChallenge(r.PostFormValue("code_verifier")) != code.challenge || r.PostFormValue("redirect_uri") != code.redirectURI {
+		WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := code.claims
+	claims.Issuer = idp.URL
+	claims.Audience = audience{"app"}
+	claims.IssuedAt = time.Now().Unix()
+	claims.ExpiresAt = time.Now().Add(time.Minute).Unix()
+
+	token, err := idp.keys.Sign(&claims)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]string{"id_token": token, "token_type": "Bearer"})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newTestIdP(t)
+	store := newTestStore(t)
+
+	provider := NewOIDCProvider(idp.URL, "app", "s3cret", "http://app.test/api/v1/auth/oidc/callback", "openid email profile")
+	service := NewOIDCService(store, provider, NewUserService(store, NewLogMailer("", io.Discard)))
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// authorize starts a login and brings back the query of the callback and
+	// the state cookie, like a browser would
+	authorize := func() (url.Values, *http.Cookie) {
+		req, err := http.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		service.handleLogin(rr, req)
+
+		if rr.Code != http.StatusFound {
+			t.Fatalf("expected status code %d, got %d", http.StatusFound, rr.Code)
+		}
+
+		res, err := noRedirects.Get(rr.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		callback, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return callback.Query(), rr.Result().Cookies()[0]
+	}
+
+	callback := func(query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, "/auth/oidc/callback?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(cookie)
+
+		rr := httptest.NewRecorder()
+		service.handleCallback(rr, req)
+		return rr
+	}
+
+	login := func(claims IDTokenClaims) *httptest.ResponseRecorder {
+		idp.mu.Lock()
+		idp.next = claims
+		idp.mu.Unlock()
+
+		return callback(authorize())
+	}
+
+	identity := func(subject string) *UserIdentity {
+		i, err := store.GetUserIdentity(idp.URL, subject)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return i
+	}
+
+	t.Run("should create the user of a first login", func(t *testing.T) {
+		rr := login(IDTokenClaims{Subject: "ada-1", Email: "ada@example.com", EmailVerified: true, Name: "Ada Lovelace"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		var tokens TokenResponse
+		if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil {
+			t.Fatal(err)
+		}
+		if tokens.AccessToken == "" {
+			t.Error("expected an access token")
+		}
+
+		u, err := store.GetUserByEmail("ada@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.FirstName != "Ada" || u.LastName != "Lovelace" || u.EmailVerifiedAt == nil {
+			t.Errorf("unexpected user %+v", u)
+		}
+		if identity("ada-1").UserID != u.ID {
+			t.Error("expected the subject to be linked to the user")
+		}
+	})
+
+	t.Run("should find the user by subject on later logins", func(t *testing.T) {
+		// the email at the provider changed, the subject did not
+		rr := login(IDTokenClaims{Subject: "ada-1", Email: "ada@lovelace.dev", EmailVerified: true})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		if _, err := store.GetUserByEmail("ada@lovelace.dev"); err == nil {
+			t.Error("expected no new user")
+		}
+	})
+
+	t.Run("should link users with the verified email", func(t *testing.T) {
+		grace, err := store.CreateUser(&CreateUserPayload{Email: "grace@example.com", FirstName: "Grace", LastName: "Hopper", Password: "hash"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.MarkEmailVerified(grace.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		if rr := login(IDTokenClaims{Subject: "grace-1", Email: "grace@example.com", EmailVerified: true}); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		if identity("grace-1").UserID != grace.ID {
+			t.Error("expected the subject to be linked to the existing user")
+		}
+	})
+
+	t.Run("should not link unverified emails", func(t *testing.T) {
+		if rr := login(IDTokenClaims{Subject: "joan-1", Email: "joan@example.com"}); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+
+		if _, err := store.CreateUser(&CreateUserPayload{Email: "eve@example.com", FirstName: "Eve", LastName: "Smith", Password: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if rr := login(IDTokenClaims{Subject: "eve-1", Email: "eve@example.com", EmailVerified: true}); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should refuse claims registration would refuse", func(t *testing.T) {
+		if rr := login(IDTokenClaims{Subject: "mallory-1", Email: "not an email", EmailVerified: true}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		if rr := login(IDTokenClaims{Subject: "mallory-1", Email: "mallory@example.com", EmailVerified: true, GivenName: strings.Repeat("a", maxUserFieldLength+1)}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should not leave a user behind when the link fails", func(t *testing.T) {
+		// ada-1 is linked already, as if a concurrent login had linked it
+		_, err := store.CreateUserWithIdentity(&CreateUserPayload{Email: "ada2@example.com", FirstName: "Ada", Password: "hash"}, time.Now(), &UserIdentity{Issuer: idp.URL, Subject: "ada-1", Email: "ada2@example.com"})
+		if !isDuplicateKey(err) {
+			t.Fatalf("expected a duplicate key, got %v", err)
+		}
+
+		if _, err := store.GetUserByEmail("ada2@example.com"); err == nil {
+			t.Error("expected no user")
+		}
+	})
+
+	t.Run("should refuse a state from another browser or used twice", func(t *testing.T) {
+		idp.next = IDTokenClaims{Subject: "ada-1"}
+		query, cookie := authorize()
+
+		if rr := callback(query, &http.Cookie{Name: oidcStateCookie, Value: "forged"}); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		if rr := callback(query, cookie); rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		if rr := callback(query, cookie); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should refuse a code issued for another login", func(t *testing.T) {
+		idp.next = IDTokenClaims{Subject: "ada-1"}
+		first, _ := authorize()
+		second, cookie := authorize()
+
+		// the code of the first login does not match the PKCE verifier of
+		// the second
+		second.Set("code", first.Get("code"))
+
+		if rr := callback(second, cookie); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := NewOIDCProvider(idp.URL, "app", "", "http://app.test/callback", "openid")
+
+	sign := func(claims IDTokenClaims) string {
+		token, err := idp.keys.Sign(&claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	now := time.Now()
+	valid := IDTokenClaims{Issuer: idp.URL, Subject: "ada-1", Audience: audience{"app"}, ExpiresAt: now.Add(time.Minute).Unix(), IssuedAt: now.Unix(), Nonce: "n"}
+
+	if _, err := provider.VerifyIDToken(sign(valid), "n"); err != nil {
+		t.Fatalf("expected the token to be valid, got %v", err)
+	}
+
+	tests := map[string]func(c *IDTokenClaims){
+		"issuer":   func(c *IDTokenClaims) { c.Issuer = "https://evil.example.com" },
+		"audience": func(c *IDTokenClaims) { c.Audience = audience{"other"} },
+		"azp":      func(c *IDTokenClaims) { c.Audience = audience{"app", "other"} },
+		"nonce":    func(c *IDTokenClaims) { c.Nonce = "replayed" },
+		"expired":  func(c *IDTokenClaims) { c.ExpiresAt = now.Add(-time.Hour).Unix() },
+	}
+
+	for name, change := range tests {
+		claims := valid
+		change(&claims)
+
+		if _, err := provider.VerifyIDToken(sign(claims), "n"); err == nil {
+			t.Errorf("expected a token with a bad %s to be refused", name)
+		}
+	}
+
+	// a string aud is as good as an array
+	var c IDTokenClaims
+	if err := json.Unmarshal([]byte(`{"aud":"app"}`), &c); err != nil || !c.Audience.contains("app") {
+		t.Errorf("expected a string audience to be read, got %v %v", c.Audience, err)
+	}
+
+	// and so is a string email_verified as a boolean
+	for body, expected := range map[string]claimBool{`{"email_verified":"true"}`: true, `{"email_verified":"false"}`: false, `{"email_verified":true}`: true} {
+		var c IDTokenClaims
+		if err := json.Unmarshal([]byte(body), &c); err != nil || c.EmailVerified != expected {
+			t.Errorf("expected %s to be read as %v, got %v %v", body, expected, c.EmailVerified, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// mergePatch applies a JSON Merge Patch (RFC 7386) to target. Objects are
+// merged recursively, null removes a member and any other value replaces it.
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergePatch(t[key], value)
+	}
+
+	return t
+}
+
+// applyMergePatch patches the JSON form of doc and decodes the result into
+// dst. Members dst does not have are rejected, so read-only fields cannot be
+// patched.
+func applyMergePatch(doc any, patch []byte, dst any) error {
+	var p any
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return err
+	}
+	if _, ok := p.(map[string]any); !ok {
+		return errInvalidPatch
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	var target map[string]any
+	if err := json.Unmarshal(b, &target); err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(mergePatch(target, p))
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	return dec.Decode(dst)
+}
+
+func isMergePatch(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == mergePatchContentType
+}
+
+func taskETag(t *Task) string {
+	return strconv.Quote(strconv.FormatInt(t.Version, 10))
+}
+
+// checkIfMatch compares the If-Match header with the current task. It returns
+// the version the update must apply to, zero when the request has no
+// precondition, and writes 412 when the precondition fails. If-Match uses the
+// strong comparison, so weak tags are refused with 400.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, task *Task) (int64, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	etag := taskETag(task)
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "W/") {
+			WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errWeakETag.Error()})
+			return 0, false
+		}
+		if value == "*" || value == etag {
+			return task.Version, true
+		}
+	}
+
+	w.Header().Set("ETag", etag)
+	WriteJSON(w, http.StatusPreconditionFailed, ErrorResponse{Error: errVersionConflict.Error()})
+	return 0, false
+}
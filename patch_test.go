@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7386, appendix A
+	tests := []struct {
+		target string
+		patch  string
+		result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	}
+
+	for _, tt := range tests {
+		var target, patch, result any
+		json.Unmarshal([]byte(tt.target), &target)
+		json.Unmarshal([]byte(tt.patch), &patch)
+		json.Unmarshal([]byte(tt.result), &result)
+
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, result) {
+			t.Errorf("patching %s with %s: expected %v, got %v", tt.target, tt.patch, result, got)
+		}
+	}
+}
+
+func TestPatchTask(t *testing.T) {
+	ms := &MockStore{}
+	service := NewTasksService(ms)
+
+	patch := func(body, contentType, ifMatch string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPatch, "/tasks/1", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks/{id}", service.handlePatchTask)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		return rr
+	}
+
+	t.Run("should only change the patched fields", func(t *testing.T) {
+		rr := patch(`{"status":"IN_PROGRESS"}`, mergePatchContentType, `"3"`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+
+		var task Task
+		if err := json.NewDecoder(rr.Body).Decode(&task); err != nil {
+			t.Fatal(err)
+		}
+
+		if task.Name != "Gears" || task.Status != StatusInProgress {
+			t.Errorf("unexpected task %+v", task)
+		}
+
+		if etag := rr.Header().Get("ETag"); etag != `"4"` {
+			t.Errorf("expected ETag %q, got %q", `"4"`, etag)
+		}
+	})
+
+	t.Run("should return 412 if the task changed", func(t *testing.T) {
+		rr := patch(`{"status":"IN_PROGRESS"}`, mergePatchContentType, `"2"`)
+		if rr.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected status code %d, got %d", http.StatusPreconditionFailed, rr.Code)
+		}
+	})
+
+	t.Run("should return error if a required field is removed", func(t *testing.T) {
+		rr := patch(`{"name":null}`, mergePatchContentType, "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return error if a read-only field is patched", func(t *testing.T) {
+		rr := patch(`{"projectId":2}`, mergePatchContentType, "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return error if the body is not a merge patch", func(t *testing.T) {
+		rr := patch(`{"status":"DONE"}`, "text/plain", "")
+		if rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status code %d, got %d", http.StatusUnsupportedMediaType, rr.Code)
+		}
+
+		rr = patch(`{"status":"DONE"}`, "application/json", "")
+		if rr.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status code %d, got %d", http.StatusUnsupportedMediaType, rr.Code)
+		}
+	})
+
+	t.Run("should return error if If-Match is weak", func(t *testing.T) {
+		rr := patch(`{"status":"IN_PROGRESS"}`, mergePatchContentType, `W/"3"`)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestTaskVersionConflict(t *testing.T) {
+	store := newTestStore(t)
+
+	u, p := newTestProject(t, store)
+
+	task, err := store.CreateTask(&CreateTaskPayload{Name: "Gears", Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edit := &EditTaskPayload{Name: "Gears", Status: StatusDone, AssignedToID: u.ID}
+
+	updated, err := store.EditTask("1", edit, task.Status, task.Version, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Version != task.Version+1 {
+		t.Errorf("expected version %d, got %d", task.Version+1, updated.Version)
+	}
+
+	if _, err := store.EditTask("1", edit, task.Status, task.Version, u.ID); err != errVersionConflict {
+		t.Errorf("expected %v, got %v", errVersionConflict, err)
+	}
+
+	// the task is DONE now, a move checked against TODO no longer holds
+	if _, err := store.EditTask("1", edit, StatusTODO, 0, u.ID); err != errStatusChanged {
+		t.Errorf("expected %v, got %v", errStatusChanged, err)
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 )
 
+const maxProjectNameLength = 255
+
 type ProjectService struct {
 	store Store
 }
@@ -17,10 +24,27 @@ func NewProjectService(s Store) *ProjectService {
 }
 
 func (s *ProjectService) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/projects", WithJWTAuth(s.handleCreateProject, s.store)).Methods("POST")
-	r.HandleFunc("/projects/{id}", WithJWTAuth(s.handleGetProject, s.store)).Methods("GET")
-	r.HandleFunc("/projects", WithJWTAuth(s.handleGetProjects, s.store)).Methods("GET")
-	r.HandleFunc("/projects/{id}", WithJWTAuth(s.handleDeleteProject, s.store)).Methods("DELETE")
+	r.HandleFunc("/projects", WithJWTAuth(s.handleCreateProject, s.store, ScopeProjectsWrite)).Methods("POST")
+	r.HandleFunc("/projects/{id}", WithJWTAuth(s.handleGetProject, s.store, ScopeProjectsRead)).Methods("GET")
+	r.HandleFunc("/projects", WithJWTAuth(s.handleGetProjects, s.store, ScopeProjectsRead)).Methods("GET")
+	r.HandleFunc("/projects/{id}", WithJWTAuth(s.handleEditProject, s.store, ScopeProjectsWrite)).Methods("PUT")
+	r.HandleFunc("/projects/{id}", WithJWTAuth(s.handlePatchProject, s.store, ScopeProjectsWrite)).Methods("PATCH")
+	r.HandleFunc("/projects/{id}", WithJWTAuth(s.handleDeleteProject, s.store, ScopeProjectsAdmin)).Methods("DELETE")
+	r.HandleFunc("/projects/{id}/archive", WithJWTAuth(s.handleArchiveProject, s.store, ScopeProjectsWrite)).Methods("POST")
+	r.HandleFunc("/projects/{id}/restore", WithJWTAuth(s.handleRestoreProject, s.store, ScopeProjectsWrite)).Methods("POST")
+	r.HandleFunc("/projects/{id}/tasks", WithJWTAuth(s.handleGetProjectTasks, s.store, ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/projects/{id}/board", WithJWTAuth(s.handleGetProjectBoard, s.store, ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/projects/{id}/activity", WithJWTAuth(s.handleGetProjectActivity, s.store, ScopeProjectsRead)).Methods("GET")
+	r.HandleFunc("/projects/{id}/labels", WithJWTAuth(s.handleGetLabels, s.store, ScopeProjectsRead)).Methods("GET")
+	r.HandleFunc("/projects/{id}/labels", WithJWTAuth(s.handleCreateLabel, s.store, ScopeProjectsWrite)).Methods("POST")
+	r.HandleFunc("/projects/{id}/labels/{labelId}", WithJWTAuth(s.handleDeleteLabel, s.store, ScopeProjectsWrite)).Methods("DELETE")
+	r.HandleFunc("/projects/{id}/workflow", WithJWTAuth(s.handleGetWorkflow, s.store, ScopeProjectsRead)).Methods("GET")
+	r.HandleFunc("/projects/{id}/workflow", WithJWTAuth(s.handleUpdateWorkflow, s.store, ScopeProjectsAdmin)).Methods("PUT")
+	r.HandleFunc("/projects/{id}/workflow", WithJWTAuth(s.handleDeleteWorkflow, s.store, ScopeProjectsAdmin)).Methods("DELETE")
+	r.HandleFunc("/projects/{id}/members", WithJWTAuth(s.handleGetProjectMembers, s.store, ScopeProjectsRead)).Methods("GET")
+	r.HandleFunc("/projects/{id}/members", WithJWTAuth(s.handleAddProjectMember, s.store, ScopeProjectsAdmin)).Methods("POST")
+	r.HandleFunc("/projects/{id}/members/{userId}", WithJWTAuth(s.handleUpdateProjectMember, s.store, ScopeProjectsAdmin)).Methods("PUT")
+	r.HandleFunc("/projects/{id}/members/{userId}", WithJWTAuth(s.handleRemoveProjectMember, s.store, ScopeProjectsAdmin)).Methods("DELETE")
 }
 
 func (s *ProjectService) handleCreateProject(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +67,13 @@ func (s *ProjectService) handleCreateProject(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	p, err := s.store.CreateProject(project)
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		permissionDenied(w)
+		return
+	}
+
+	p, err := s.store.CreateProject(project, principal.UserID)
 	if err != nil {
 		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while creating the project"})
 		return
@@ -53,52 +83,353 @@ func (s *ProjectService) handleCreateProject(w http.ResponseWriter, r *http.Requ
 }
 
 func (s *ProjectService) handleGetProject(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	project, _, ok := s.loadProject(w, r, RoleViewer)
+	if !ok {
+		return
+	}
 
-	if id == "" {
-		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "id is required"})
+	WriteJSON(w, http.StatusOK, project)
+}
+
+// handleGetProjects lists the active projects of the caller, or the archived
+// ones with ?archived=true.
+func (s *ProjectService) handleGetProjects(w http.ResponseWriter, r *http.Request) {
+	archived := r.URL.Query().Get("archived") == "true"
+
+	projects, err := s.store.GetProjects(GetUserIDFromContext(r.Context()), archived)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "projects not found"})
 		return
 	}
 
-	project, err := s.store.GetProject(id)
+	WriteJSON(w, http.StatusOK, projects)
+}
+
+func (s *ProjectService) handleEditProject(w http.ResponseWriter, r *http.Request) {
+	project, member, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "project not found"})
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, project)
+	defer r.Body.Close()
+
+	var payload *EditProjectPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	s.updateProject(w, r, project, member, payload)
 }
 
-func (s *ProjectService) handleGetProjects(w http.ResponseWriter, r *http.Request) {
-	projects, err := s.store.GetProjects()
+// handlePatchProject applies a JSON Merge Patch to the project.
+func (s *ProjectService) handlePatchProject(w http.ResponseWriter, r *http.Request) {
+	project, member, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	if !isMergePatch(r) {
+		WriteJSON(w, http.StatusUnsupportedMediaType, ErrorResponse{Error: errUnsupportedPatch.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "projects not found"})
 		return
 	}
 
-	WriteJSON(w, http.StatusOK, projects)
+	defer r.Body.Close()
+
+	current := &EditProjectPayload{Name: project.Name, Description: project.Description, OwnerID: project.OwnerID}
+
+	var payload EditProjectPayload
+	if err := applyMergePatch(current, body, &payload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid merge patch: " + err.Error()})
+		return
+	}
+
+	s.updateProject(w, r, project, member, &payload)
+}
+
+// updateProject validates and saves the new values of the project. Archived
+// projects are read-only, and only owners may hand the project to another
+// member. A project whose owner was deleted has none until one is given.
+func (s *ProjectService) updateProject(w http.ResponseWriter, r *http.Request, project *Project, member *ProjectMember, payload *EditProjectPayload) {
+	if project.ArchivedAt != nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errProjectArchived.Error()})
+		return
+	}
+
+	if err := validateEditProjectPayload(payload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if payload.OwnerID != project.OwnerID {
+		if payload.OwnerID == 0 {
+			WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errUserIDRequired.Error()})
+			return
+		}
+
+		if !hasRole(member.Role, RoleOwner) {
+			WriteJSON(w, http.StatusForbidden, ErrorResponse{Error: errOnlyOwnerTransfers.Error()})
+			return
+		}
+
+		_, err := s.store.GetProjectMember(project.ID, payload.OwnerID)
+		if errors.Is(err, sql.ErrNoRows) {
+			WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errOwnerNotMember.Error()})
+			return
+		}
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while checking project membership"})
+			return
+		}
+	}
+
+	p, err := s.store.EditProject(project.ID, payload, GetUserIDFromContext(r.Context()))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while updating the project"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, p)
+}
+
+// handleArchiveProject hides the project and makes its tasks read-only.
+func (s *ProjectService) handleArchiveProject(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	if project.ArchivedAt != nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errProjectArchived.Error()})
+		return
+	}
+
+	p, err := s.store.SetProjectArchived(project.ID, true, GetUserIDFromContext(r.Context()))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while archiving the project"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, p)
+}
+
+func (s *ProjectService) handleRestoreProject(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	if project.ArchivedAt == nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errProjectNotArchived.Error()})
+		return
+	}
+
+	p, err := s.store.SetProjectArchived(project.ID, false, GetUserIDFromContext(r.Context()))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while restoring the project"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, p)
 }
 
+// handleDeleteProject moves the project with all its tasks to the trash, or
+// removes them for good with ?permanent=true. The owner confirms by passing
+// the project name as ?confirm=.
 func (s *ProjectService) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	err := s.store.DeleteProject(id)
+	project, _, ok := s.loadProject(w, r, RoleOwner)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("confirm") != project.Name {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errDeleteConfirmation.Error()})
+		return
+	}
+
+	err := s.store.DeleteProject(id, GetUserIDFromContext(r.Context()))
 	if err != nil {
-		// WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error deleting project"})
-		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while deleting the project"})
 		return
 	}
 
+	if r.URL.Query().Get("permanent") == "true" {
+		if err := s.store.PurgeProject(project.ID); err != nil {
+			WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while deleting the project"})
+			return
+		}
+	}
+
 	WriteJSON(w, http.StatusNoContent, nil)
 }
 
+func (s *ProjectService) handleGetProjectTasks(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	filter, err := parseTaskListFilter(r)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	filter.ProjectID = project.ID
+
+	page, err := s.store.ListTasks(filter)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing tasks"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, page)
+}
+
+func (s *ProjectService) handleGetProjectBoard(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	workflow, err := s.store.GetWorkflow(project.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the board"})
+		return
+	}
+
+	tasks, err := s.store.GetProjectTasks(project.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the board"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, buildBoard(project, workflow, tasks))
+}
+
+// loadProject loads the project named by the {id} route variable once the
+// caller is authorized for it with at least minRole, and writes the error
+// response otherwise. The returned bool reports whether the handler may
+// continue.
+func (s *ProjectService) loadProject(w http.ResponseWriter, r *http.Request, minRole string) (*Project, *ProjectMember, bool) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "id is required"})
+		return nil, nil, false
+	}
+
+	projectID, err := parseIDParam(id)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return nil, nil, false
+	}
+
+	member, ok := authorizeProject(s.store, w, r, projectID, minRole)
+	if !ok {
+		return nil, nil, false
+	}
+
+	project, err := s.store.GetProject(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "project not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the project"})
+		return nil, nil, false
+	}
+
+	return project, member, true
+}
+
+// buildBoard has one column per workflow state, in workflow order.
+func buildBoard(project *Project, workflow *Workflow, tasks []*Task) *ProjectBoard {
+	board := &ProjectBoard{Project: project}
+	columns := make(map[string]*BoardColumn, len(workflow.States))
+
+	for _, state := range workflow.States {
+		column := &BoardColumn{Status: state.Name, Tasks: []*Task{}}
+		columns[state.Name] = column
+		board.Columns = append(board.Columns, column)
+	}
+
+	for _, t := range tasks {
+		column, ok := columns[t.Status]
+		if !ok {
+			continue
+		}
+		column.Tasks = append(column.Tasks, t)
+		column.Count++
+	}
+
+	return board
+}
 
 func validateProjectPayload(project *CreateProjectPayload) error {
 	if project.Name == "" {
 		return errNameRequired
 	}
 
+	if utf8.RuneCountInString(project.Name) > maxProjectNameLength {
+		return errNameTooLong
+	}
+
+	if utf8.RuneCountInString(project.Description) > maxDescriptionLength {
+		return errDescriptionTooLong
+	}
+
 	return nil
+}
+
+func validateEditProjectPayload(project *EditProjectPayload) error {
+	project.Name = strings.TrimSpace(project.Name)
+
+	if project.Name == "" {
+		return errNameRequired
+	}
+
+	if utf8.RuneCountInString(project.Name) > maxProjectNameLength {
+		return errNameTooLong
+	}
+
+	if utf8.RuneCountInString(project.Description) > maxDescriptionLength {
+		return errDescriptionTooLong
+	}
+
+	return nil
+}
+
+// checkProjectWritable refuses changes to the tasks of archived projects.
+func checkProjectWritable(store Store, w http.ResponseWriter, projectID int64) bool {
+	project, err := store.GetProject(strconv.FormatInt(projectID, 10))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "project not found"})
+		return false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the project"})
+		return false
+	}
+
+	if project.ArchivedAt != nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errProjectArchived.Error()})
+		return false
+	}
+
+	return true
 }
\ No newline at end of file
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestGetProjectBoard(t *testing.T) {
+	ms := &MockStore{}
+	service := NewProjectService(ms)
+
+	t.Run("should group tasks by status", func(t *testing.T) {
+		tasks := []*Task{
+			{ID: 1, Status: StatusTODO},
+			{ID: 2, Status: StatusDone},
+			{ID: 3, Status: StatusTODO},
+		}
+
+		board := buildBoard(&Project{ID: 1}, DefaultWorkflow(1), tasks)
+
+		if len(board.Columns) != len(defaultStatuses) {
+			t.Fatalf("expected %d columns, got %d", len(defaultStatuses), len(board.Columns))
+		}
+
+		expected := map[string]int{StatusTODO: 2, StatusInProgress: 0, StatusInTesting: 0, StatusDone: 1}
+		for i, column := range board.Columns {
+			if column.Status != defaultStatuses[i] {
+				t.Errorf("expected column %d to be %s, got %s", i, defaultStatuses[i], column.Status)
+			}
+			if column.Count != expected[column.Status] || len(column.Tasks) != column.Count {
+				t.Errorf("expected %d tasks in %s, got %d", expected[column.Status], column.Status, column.Count)
+			}
+		}
+	})
+
+	t.Run("should return the board", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/projects/1/board", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/projects/{id}/board", service.handleGetProjectBoard)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var board ProjectBoard
+		if err := json.NewDecoder(rr.Body).Decode(&board); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(board.Columns) != len(defaultStatuses) {
+			t.Errorf("expected %d columns, got %d", len(defaultStatuses), len(board.Columns))
+		}
+	})
+}
+
+func TestAddProjectMember(t *testing.T) {
+	ms := &MockStore{}
+	service := NewProjectService(ms)
+
+	t.Run("should return error if role is invalid", func(t *testing.T) {
+		payload := &AddProjectMemberPayload{UserID: 2, Role: "admin"}
+
+		b, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "/projects/1/members", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/projects/{id}/members", service.handleAddProjectMember)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return not found for an unknown user", func(t *testing.T) {
+		store := newTestStore(t)
+		u, p := newTestProject(t, store)
+
+		b, err := json.Marshal(&AddProjectMemberPayload{UserID: u.ID + 1, Role: RoleMember})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/projects/%d/members", p.ID), bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/projects/{id}/members", NewProjectService(store).handleAddProjectMember)
+		router.ServeHTTP(rr, withUserID(req, u.ID))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should require an authenticated user", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/projects/1/members", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/projects/{id}/members", service.handleAddProjectMember)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestDeleteProject(t *testing.T) {
+	ms := &MockStore{}
+	service := NewProjectService(ms)
+
+	remove := func(url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodDelete, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/projects/{id}", service.handleDeleteProject)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		return rr
+	}
+
+	t.Run("should require the project name as confirmation", func(t *testing.T) {
+		rr := remove("/projects/1?confirm=engine")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should delete a confirmed project", func(t *testing.T) {
+		rr := remove("/projects/1?confirm=Engine")
+		if rr.Code != http.StatusNoContent {
+			t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+	})
+}
+
+func TestPatchProject(t *testing.T) {
+	ms := &MockStore{}
+	service := NewProjectService(ms)
+
+	req, err := http.NewRequest(http.MethodPatch, "/projects/1", bytes.NewBufferString(`{"description":"Gears and oil","ownerId":2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mergePatchContentType)
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+
+	router.HandleFunc("/projects/{id}", service.handlePatchProject)
+	router.ServeHTTP(rr, withUserID(req, 1))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var project Project
+	if err := json.NewDecoder(rr.Body).Decode(&project); err != nil {
+		t.Fatal(err)
+	}
+
+	if project.Name != "Engine" || project.Description != "Gears and oil" || project.OwnerID != 2 {
+		t.Errorf("unexpected project %+v", project)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenRevoker records revoked access tokens by their jti until they expire.
+// Storage implements it on top of SQL, MemoryRevocationStore for a single
+// instance.
+type TokenRevoker interface {
+	RevokeToken(tokenID string, expiresAt time.Time) error
+	IsTokenRevoked(tokenID string) (bool, error)
+}
+
+type MemoryRevocationStore struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{tokens: map[string]time.Time{}}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range s.tokens {
+		if now.After(exp) {
+			delete(s.tokens, id)
+		}
+	}
+
+	s.tokens[tokenID] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsTokenRevoked(tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.tokens[tokenID]
+	return ok, nil
+}
+
+// tokenRevocations is consulted by WithJWTAuth on every request.
+var tokenRevocations = newRevocationCache(Envs.RevocationCacheTTL)
+
+// revocationSweepMin is the size under which the cache is never swept.
+const revocationSweepMin = 1024
+
+type revocationEntry struct {
+	revoked   bool
+	checkedAt time.Time
+}
+
+// revocationCache remembers revocation lookups for a short while so the
+// backend is not queried on every request. Revocations made through the cache
+// apply at once on this instance and within ttl on the others.
+type revocationCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	backend TokenRevoker
+	entries map[string]revocationEntry
+	sweepAt int
+}
+
+func newRevocationCache(ttl time.Duration) *revocationCache {
+	return &revocationCache{ttl: ttl, entries: map[string]revocationEntry{}, sweepAt: revocationSweepMin}
+}
+
+// SetBackend replaces the store passed to WithJWTAuth as revocation backend.
+func (c *revocationCache) SetBackend(backend TokenRevoker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.backend = backend
+	c.entries = map[string]revocationEntry{}
+	c.sweepAt = revocationSweepMin
+}
+
+func (c *revocationCache) revoker(store Store) TokenRevoker {
+	if c.backend != nil {
+		return c.backend
+	}
+
+	return store
+}
+
+func (c *revocationCache) Revoke(store Store, tokenID string, expiresAt time.Time) error {
+	c.mu.Lock()
+	revoker := c.revoker(store)
+	c.mu.Unlock()
+
+	// the backend is not called under the lock, a slow database would hold
+	// up every request checking a token
+	if err := revoker.RevokeToken(tokenID, expiresAt); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[tokenID] = revocationEntry{revoked: true, checkedAt: time.Now()}
+	return nil
+}
+
+func (c *revocationCache) IsRevoked(store Store, tokenID string) (bool, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[tokenID]
+	revoker := c.revoker(store)
+	c.mu.Unlock()
+
+	if ok && (entry.revoked || time.Since(entry.checkedAt) < c.ttl) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := revoker.IsTokenRevoked(tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.sweepAt {
+		c.sweep(now)
+	}
+	c.entries[tokenID] = revocationEntry{revoked: revoked, checkedAt: now}
+
+	return revoked, nil
+}
+
+// sweep drops the stale entries, revoked tokens are remembered until they
+// would have expired anyway. The next sweep waits for the cache to double, so
+// lookups pay for sweeping in amortized constant time.
+func (c *revocationCache) sweep(now time.Time) {
+	for id, e := range c.entries {
+		age := now.Sub(e.checkedAt)
+		if (!e.revoked && age >= c.ttl) || age >= Envs.AccessTokenTTL {
+			delete(c.entries, id)
+		}
+	}
+
+	c.sweepAt = max(2*len(c.entries), revocationSweepMin)
+}
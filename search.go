@@ -0,0 +1,325 @@
+package main
+
+import (
+	"database/sql"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	SearchKindTask    = "task"
+	SearchKindProject = "project"
+	SearchKindComment = "comment"
+)
+
+const (
+	maxSearchQueryLength = 256
+	snippetLength        = 160
+)
+
+// Searcher finds tasks, projects and comments matching a query. SQLSearcher
+// uses the MySQL full-text indexes, SearchIndex is kept in process for the
+// other backends.
+type Searcher interface {
+	Search(q *SearchQuery) ([]*SearchResult, error)
+}
+
+type SearchService struct {
+	store    Store
+	searcher Searcher
+}
+
+func NewSearchService(s Store, searcher Searcher) *SearchService {
+	return &SearchService{store: s, searcher: searcher}
+}
+
+func (s *SearchService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/search", WithJWTAuth(s.handleSearch, s.store, ScopeTasksRead, ScopeProjectsRead)).Methods("GET")
+}
+
+// handleSearch searches the projects the caller is a member of, or a single
+// one with ?projectId=. ?type=task,comment limits the kinds of results.
+func (s *SearchService) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	query := &SearchQuery{Text: strings.TrimSpace(q.Get("q"))}
+	if query.Text == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errSearchQueryRequired.Error()})
+		return
+	}
+	if utf8.RuneCountInString(query.Text) > maxSearchQueryLength {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errSearchQueryTooLong.Error()})
+		return
+	}
+
+	for _, value := range q["type"] {
+		for _, kind := range strings.Split(value, ",") {
+			if kind != SearchKindTask && kind != SearchKindProject && kind != SearchKindComment {
+				WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidSearchType.Error()})
+				return
+			}
+			query.Kinds = append(query.Kinds, kind)
+		}
+	}
+
+	var err error
+	if query.Limit, err = parseLimit(r); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	projectID, err := parseIDParam(q.Get("projectId"))
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if projectID != 0 {
+		if _, ok := authorizeProject(s.store, w, r, projectID, RoleViewer); !ok {
+			return
+		}
+		query.ProjectIDs = []int64{projectID}
+	} else {
+		// archived projects are only searched when asked for explicitly
+		userID := GetUserIDFromContext(r.Context())
+		if userID == 0 {
+			permissionDenied(w)
+			return
+		}
+
+		projects, err := s.store.GetProjects(userID, false)
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while searching"})
+			return
+		}
+		for _, p := range projects {
+			query.ProjectIDs = append(query.ProjectIDs, p.ID)
+		}
+	}
+
+	results := []*SearchResult{}
+	if len(query.ProjectIDs) > 0 {
+		results, err = s.searcher.Search(query)
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while searching"})
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, &SearchResponse{Results: results})
+}
+
+type span struct {
+	start, end int
+}
+
+// tokenSpans returns the byte offsets of the words of text. Words are runs of
+// letters and digits.
+func tokenSpans(text string) []span {
+	var spans []span
+	start := -1
+
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		}
+		if !word && start >= 0 {
+			spans = append(spans, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(text)})
+	}
+
+	return spans
+}
+
+// tokenize splits text into lower case terms.
+func tokenize(text string) []string {
+	var terms []string
+	for _, sp := range tokenSpans(text) {
+		terms = append(terms, strings.ToLower(text[sp.start:sp.end]))
+	}
+
+	return terms
+}
+
+// highlight returns a snippet of text around the first matched term, with
+// every matched term wrapped in <mark>. It returns "" if nothing matches.
+func highlight(text string, terms map[string]bool) string {
+	var matches []span
+	for _, sp := range tokenSpans(text) {
+		if terms[strings.ToLower(text[sp.start:sp.end])] {
+			matches = append(matches, sp)
+		}
+	}
+
+	if len(matches) == 0 {
+		return ""
+	}
+
+	// start the snippet a little before the first match, on a rune boundary
+	from := matches[0].start - snippetLength/4
+	if from < 0 {
+		from = 0
+	}
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+
+	to := from + snippetLength
+	if to >= len(text) {
+		to = len(text)
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+
+	pos := from
+	for _, m := range matches {
+		if m.start < from {
+			continue
+		}
+		if m.end > to {
+			break
+		}
+		b.WriteString(html.EscapeString(text[pos:m.start]))
+		b.WriteString("<mark>" + html.EscapeString(text[m.start:m.end]) + "</mark>")
+		pos = m.end
+	}
+	b.WriteString(html.EscapeString(text[pos:to]))
+
+	if to < len(text) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+// newSearchResult highlights the body of the document, or its title when
+// only the title matches.
+func newSearchResult(doc *SearchDocument, terms map[string]bool, score float64) *SearchResult {
+	snippet := highlight(doc.Body, terms)
+	if snippet == "" {
+		snippet = highlight(doc.Title, terms)
+	}
+
+	return &SearchResult{
+		Kind:      doc.Kind,
+		ID:        doc.ID,
+		ProjectID: doc.ProjectID,
+		TaskID:    doc.TaskID,
+		Title:     doc.Title,
+		Highlight: snippet,
+		Score:     score,
+	}
+}
+
+func termSet(text string) map[string]bool {
+	terms := map[string]bool{}
+	for _, t := range tokenize(text) {
+		terms[t] = true
+	}
+
+	return terms
+}
+
+func wantsKind(q *SearchQuery, kind string) bool {
+	if len(q.Kinds) == 0 {
+		return true
+	}
+
+	for _, k := range q.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SQLSearcher ranks with MySQL natural language full-text search, see
+// migration 0013.
+type SQLSearcher struct {
+	db *sql.DB
+}
+
+func NewSQLSearcher(db *sql.DB) *SQLSearcher {
+	return &SQLSearcher{db: db}
+}
+
+func (s *SQLSearcher) Search(q *SearchQuery) ([]*SearchResult, error) {
+	in := "(?" + strings.Repeat(", ?", len(q.ProjectIDs)-1) + ")"
+
+	var parts []string
+	var args []any
+
+	add := func(kind, query string) {
+		if !wantsKind(q, kind) {
+			return
+		}
+		parts = append(parts, query)
+		args = append(args, q.Text, q.Text)
+		for _, id := range q.ProjectIDs {
+			args = append(args, id)
+		}
+	}
+
+	add(SearchKindTask, "SELECT 'task', id, projectId, 0, name, COALESCE(description, ''), MATCH (name, description) AGAINST (?) AS score "+
+		"FROM tasks WHERE MATCH (name, description) AGAINST (?) AND "+liveTasks+" AND projectId IN "+in)
+	add(SearchKindProject, "SELECT 'project', id, id, 0, name, COALESCE(description, ''), MATCH (name, description) AGAINST (?) AS score "+
+		"FROM projects WHERE MATCH (name, description) AGAINST (?) AND deletedAt IS NULL AND id IN "+in)
+	add(SearchKindComment, "SELECT 'comment', c.id, t.projectId, c.taskId, '', c.body, MATCH (c.body) AGAINST (?) AS score "+
+		"FROM comments c JOIN tasks t ON t.id = c.taskId WHERE MATCH (c.body) AGAINST (?) AND "+liveTasks+" AND t.projectId IN "+in)
+
+	query := strings.Join(parts, " UNION ALL ") + " ORDER BY score DESC LIMIT " + strconv.Itoa(q.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := termSet(q.Text)
+	results := []*SearchResult{}
+
+	for rows.Next() {
+		var doc SearchDocument
+		var score float64
+		if err := rows.Scan(&doc.Kind, &doc.ID, &doc.ProjectID, &doc.TaskID, &doc.Title, &doc.Body, &score); err != nil {
+			return nil, err
+		}
+		results = append(results, newSearchResult(&doc, terms, score))
+	}
+
+	return results, rows.Err()
+}
+
+// sortResults orders results by descending score, ties by kind and id so
+// pages are stable.
+func sortResults(results []*SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID < b.ID
+	})
+}
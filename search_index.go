@@ -0,0 +1,306 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync"
+)
+
+// titleWeight counts a term of the title as that many terms of the body.
+const titleWeight = 2
+
+type docKey struct {
+	kind string
+	id   int64
+}
+
+type indexedDoc struct {
+	doc    *SearchDocument
+	length float64
+	terms  []string
+}
+
+// SearchIndex is an in-process inverted index, used to search SQLite which
+// has no full-text indexes in this project. Documents are ranked by tf-idf
+// and any term of the query may match.
+type SearchIndex struct {
+	mu       sync.RWMutex
+	docs     map[docKey]*indexedDoc
+	postings map[string]map[docKey]float64
+}
+
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{
+		docs:     map[docKey]*indexedDoc{},
+		postings: map[string]map[docKey]float64{},
+	}
+}
+
+// Add indexes the document, replacing a previous version of it.
+func (idx *SearchIndex) Add(doc *SearchDocument) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key := docKey{doc.Kind, doc.ID}
+	idx.remove(key)
+
+	weights := map[string]float64{}
+	for _, t := range tokenize(doc.Title) {
+		weights[t] += titleWeight
+	}
+	for _, t := range tokenize(doc.Body) {
+		weights[t]++
+	}
+
+	var length float64
+	terms := make([]string, 0, len(weights))
+	for term, w := range weights {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[docKey]float64{}
+		}
+		idx.postings[term][key] = w
+		length += w
+		terms = append(terms, term)
+	}
+
+	idx.docs[key] = &indexedDoc{doc: doc, length: length, terms: terms}
+}
+
+func (idx *SearchIndex) Remove(kind string, id int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(docKey{kind, id})
+}
+
+// RemoveTask removes the task and its comments.
+func (idx *SearchIndex) RemoveTask(id int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(docKey{SearchKindTask, id})
+	for key, d := range idx.docs {
+		if key.kind == SearchKindComment && d.doc.TaskID == id {
+			idx.remove(key)
+		}
+	}
+}
+
+// RemoveProject removes the project with its tasks and comments.
+func (idx *SearchIndex) RemoveProject(id int64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for key, d := range idx.docs {
+		if d.doc.ProjectID == id {
+			idx.remove(key)
+		}
+	}
+}
+
+func (idx *SearchIndex) remove(key docKey) {
+	d := idx.docs[key]
+	if d == nil {
+		return
+	}
+
+	for _, term := range d.terms {
+		docs := idx.postings[term]
+		delete(docs, key)
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, key)
+}
+
+func (idx *SearchIndex) Search(q *SearchQuery) ([]*SearchResult, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	projects := map[int64]bool{}
+	for _, id := range q.ProjectIDs {
+		projects[id] = true
+	}
+
+	terms := termSet(q.Text)
+	scores := map[docKey]float64{}
+	n := float64(len(idx.docs))
+
+	for term := range terms {
+		docs := idx.postings[term]
+		idf := math.Log(1 + n/float64(len(docs)))
+
+		for key, tf := range docs {
+			d := idx.docs[key]
+			if !projects[d.doc.ProjectID] || !wantsKind(q, key.kind) {
+				continue
+			}
+			scores[key] += idf * tf / math.Sqrt(d.length)
+		}
+	}
+
+	results := []*SearchResult{}
+	for key, score := range scores {
+		results = append(results, newSearchResult(idx.docs[key].doc, terms, score))
+	}
+
+	sortResults(results)
+	if len(results) > q.Limit {
+		results = results[:q.Limit]
+	}
+
+	return results, nil
+}
+
+// indexedStore keeps a SearchIndex in sync with the changes made through
+// the store.
+type indexedStore struct {
+	Store
+	index *SearchIndex
+}
+
+func NewIndexedStore(s Store, index *SearchIndex) Store {
+	return &indexedStore{Store: s, index: index}
+}
+
+func (s *indexedStore) CreateProject(p *CreateProjectPayload, ownerID int64) (*Project, error) {
+	project, err := s.Store.CreateProject(p, ownerID)
+	if err == nil {
+		s.index.Add(projectDocument(project))
+	}
+
+	return project, err
+}
+
+func (s *indexedStore) EditProject(id int64, p *EditProjectPayload, actorID int64) (*Project, error) {
+	project, err := s.Store.EditProject(id, p, actorID)
+	if err == nil {
+		s.index.Add(projectDocument(project))
+	}
+
+	return project, err
+}
+
+func (s *indexedStore) DeleteProject(id string, actorID int64) error {
+	err := s.Store.DeleteProject(id, actorID)
+	if err == nil {
+		projectID, _ := strconv.ParseInt(id, 10, 64)
+		s.index.RemoveProject(projectID)
+	}
+
+	return err
+}
+
+func (s *indexedStore) RestoreProject(id int64, actorID int64) (*Project, error) {
+	project, err := s.Store.RestoreProject(id, actorID)
+	if err == nil {
+		err = s.reindex(id, func(d *SearchDocument) bool { return true })
+	}
+
+	return project, err
+}
+
+func (s *indexedStore) CreateTask(t *CreateTaskPayload, createdByID int64) (*Task, error) {
+	task, err := s.Store.CreateTask(t, createdByID)
+	if err == nil {
+		s.index.Add(taskDocument(task))
+	}
+
+	return task, err
+}
+
+func (s *indexedStore) EditTask(id string, t *EditTaskPayload, from string, version int64, actorID int64) (*Task, error) {
+	task, err := s.Store.EditTask(id, t, from, version, actorID)
+	if err == nil {
+		s.index.Add(taskDocument(task))
+	}
+
+	return task, err
+}
+
+func (s *indexedStore) DeleteTask(id string, actorID int64) error {
+	err := s.Store.DeleteTask(id, actorID)
+	if err == nil {
+		taskID, _ := strconv.ParseInt(id, 10, 64)
+		s.index.RemoveTask(taskID)
+	}
+
+	return err
+}
+
+func (s *indexedStore) RestoreTask(id int64, status string, actorID int64) (*Task, error) {
+	task, err := s.Store.RestoreTask(id, status, actorID)
+	if err == nil {
+		err = s.reindex(task.ProjectID, func(d *SearchDocument) bool {
+			return d.Kind == SearchKindTask && d.ID == id || d.Kind == SearchKindComment && d.TaskID == id
+		})
+	}
+
+	return task, err
+}
+
+// reindex adds the documents of the project that match back to the index.
+func (s *indexedStore) reindex(projectID int64, match func(d *SearchDocument) bool) error {
+	docs, err := s.Store.SearchDocuments(projectID)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range docs {
+		if match(d) {
+			s.index.Add(d)
+		}
+	}
+
+	return nil
+}
+
+func (s *indexedStore) CreateComment(taskID, authorID int64, body string) (*Comment, error) {
+	c, err := s.Store.CreateComment(taskID, authorID, body)
+	if err == nil {
+		err = s.indexComment(c)
+	}
+
+	return c, err
+}
+
+func (s *indexedStore) UpdateComment(id int64, body string) (*Comment, error) {
+	c, err := s.Store.UpdateComment(id, body)
+	if err == nil {
+		err = s.indexComment(c)
+	}
+
+	return c, err
+}
+
+func (s *indexedStore) DeleteComment(id int64) error {
+	err := s.Store.DeleteComment(id)
+	if err == nil {
+		s.index.Remove(SearchKindComment, id)
+	}
+
+	return err
+}
+
+func (s *indexedStore) indexComment(c *Comment) error {
+	task, err := s.Store.GetTask(strconv.FormatInt(c.TaskID, 10))
+	if err != nil {
+		return err
+	}
+
+	s.index.Add(commentDocument(c, task.ProjectID))
+	return nil
+}
+
+func taskDocument(t *Task) *SearchDocument {
+	return &SearchDocument{Kind: SearchKindTask, ID: t.ID, ProjectID: t.ProjectID, Title: t.Name, Body: t.Description}
+}
+
+func projectDocument(p *Project) *SearchDocument {
+	return &SearchDocument{Kind: SearchKindProject, ID: p.ID, ProjectID: p.ID, Title: p.Name, Body: p.Description}
+}
+
+func commentDocument(c *Comment, projectID int64) *SearchDocument {
+	return &SearchDocument{Kind: SearchKindComment, ID: c.ID, ProjectID: projectID, TaskID: c.TaskID, Body: c.Body}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTokenize(t *testing.T) {
+	terms := tokenize("Fix the Gear-box, v2 (ÄRGER)!")
+	expected := []string{"fix", "the", "gear", "box", "v2", "ärger"}
+
+	if len(terms) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, terms)
+	}
+	for i := range terms {
+		if terms[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, terms)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"marks every match", "Oil the gears, then check the GEARS", "Oil the <mark>gears</mark>, then check the <mark>GEARS</mark>"},
+		{"escapes html", "<b>gears</b> & co", "&lt;b&gt;<mark>gears</mark>&lt;/b&gt; &amp; co"},
+		{"no match", "Oil the chain", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if snippet := highlight(tt.text, termSet("gears")); snippet != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, snippet)
+			}
+		})
+	}
+
+	t.Run("cuts long texts around the match", func(t *testing.T) {
+		long := ""
+		for i := 0; i < 100; i++ {
+			long += "word" + strconv.Itoa(i) + " "
+		}
+
+		snippet := highlight(long, termSet("word50"))
+		if len(snippet) > snippetLength+30 || snippet[:3] != "…" || snippet[len(snippet)-3:] != "…" {
+			t.Errorf("unexpected snippet %q", snippet)
+		}
+	})
+}
+
+func TestSearchIndex(t *testing.T) {
+	index := NewSearchIndex()
+	store := NewIndexedStore(newTestStore(t), index)
+
+	u, engine := newTestProject(t, store)
+
+	secret, err := store.CreateProject(&CreateProjectPayload{Name: "Secret gears"}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gears, err := store.CreateTask(&CreateTaskPayload{Name: "Gears", Status: StatusTODO, ProjectID: engine.ID, AssignedToID: u.ID, TaskDetails: TaskDetails{Description: "Replace the worn gears"}}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oil, err := store.CreateTask(&CreateTaskPayload{Name: "Oil", Status: StatusTODO, ProjectID: engine.ID, AssignedToID: u.ID}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comment, err := store.CreateComment(oil.ID, u.ID, "the gears need oil too")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(q *SearchQuery) []*SearchResult {
+		q.Limit = 10
+		results, err := index.Search(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	t.Run("should rank and scope results", func(t *testing.T) {
+		results := search(&SearchQuery{Text: "gears", ProjectIDs: []int64{engine.ID}})
+		if len(results) != 2 {
+			t.Fatalf("expected 2 results, got %d", len(results))
+		}
+		if results[0].Kind != SearchKindTask || results[0].ID != gears.ID {
+			t.Errorf("expected task %d first, got %s %d", gears.ID, results[0].Kind, results[0].ID)
+		}
+		if results[1].Kind != SearchKindComment || results[1].TaskID != oil.ID {
+			t.Errorf("expected the comment second, got %+v", results[1])
+		}
+		if results[1].Highlight != "the <mark>gears</mark> need oil too" {
+			t.Errorf("unexpected highlight %q", results[1].Highlight)
+		}
+	})
+
+	t.Run("should filter by kind", func(t *testing.T) {
+		results := search(&SearchQuery{Text: "gears", Kinds: []string{SearchKindProject}, ProjectIDs: []int64{engine.ID, secret.ID}})
+		if len(results) != 1 || results[0].ID != secret.ID {
+			t.Errorf("expected project %d, got %v", secret.ID, results)
+		}
+	})
+
+	t.Run("should follow updates and deletes", func(t *testing.T) {
+		if _, err := store.UpdateComment(comment.ID, "all good"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.DeleteTask(strconv.FormatInt(gears.ID, 10), u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if results := search(&SearchQuery{Text: "gears", ProjectIDs: []int64{engine.ID}}); len(results) != 0 {
+			t.Errorf("expected no results, got %v", results)
+		}
+		if _, ok := index.postings["worn"]; ok {
+			t.Error("expected the terms of the deleted task to leave the index")
+		}
+
+		if err := store.DeleteProject(strconv.FormatInt(engine.ID, 10), u.ID); err != nil {
+			t.Fatal(err)
+		}
+		if results := search(&SearchQuery{Text: "good oil", ProjectIDs: []int64{engine.ID}}); len(results) != 0 {
+			t.Errorf("expected no results, got %v", results)
+		}
+	})
+}
+
+func TestHandleSearch(t *testing.T) {
+	index := NewSearchIndex()
+	index.Add(&SearchDocument{Kind: SearchKindTask, ID: 1, ProjectID: 1, Title: "Gears"})
+	index.Add(&SearchDocument{Kind: SearchKindTask, ID: 2, ProjectID: 2, Title: "Gears"})
+
+	service := NewSearchService(&MockStore{}, index)
+
+	search := func(url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/search", service.handleSearch)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		return rr
+	}
+
+	t.Run("should require a query", func(t *testing.T) {
+		rr := search("/search?q=%20")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should refuse unknown types", func(t *testing.T) {
+		rr := search("/search?q=gears&type=user")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should search a single project", func(t *testing.T) {
+		rr := search("/search?q=gears&projectId=2")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response SearchResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Results) != 1 || response.Results[0].ID != 2 {
+			t.Errorf("expected task 2, got %v", response.Results)
+		}
+	})
+
+	t.Run("should only search the projects of the user", func(t *testing.T) {
+		rr := search("/search?q=gears")
+
+		var response SearchResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Results) != 0 {
+			t.Errorf("expected no results, got %v", response.Results)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStorage runs the server on an embedded, cgo-free SQLite database so
+// it can be started without an external database server.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(path string) *SQLiteStorage {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// SQLite allows a single writer, and an in-memory database only lives as
+	// long as its connection.
+	db.SetMaxOpenConns(1)
+
+	err = db.Ping()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("Opened SQLite database", path)
+
+	return &SQLiteStorage{db: db}
+}
+
+func (s *SQLiteStorage) Migrator() (*Migrator, error) {
+	return NewMigrator(s.db, "sqlite")
+}
+
+func (s *SQLiteStorage) Init() (*sql.DB, error) {
+	m, err := s.Migrator()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Up(); err != nil {
+		return nil, err
+	}
+
+	return s.db, nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Storage {
+	t.Helper()
+
+	sqlStorage := NewSQLiteStorage(":memory:")
+	db, err := sqlStorage.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return NewStore(db)
+}
+
+// newTestUser creates Ada, the user most tests act as.
+func newTestUser(t *testing.T, store Store) *User {
+	t.Helper()
+
+	u, err := store.CreateUser(&CreateUserPayload{Email: "ada@example.com", FirstName: "Ada", LastName: "Lovelace", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u
+}
+
+// newTestProject creates Ada and the Engine project she owns.
+func newTestProject(t *testing.T, store Store) (*User, *Project) {
+	t.Helper()
+
+	u := newTestUser(t, store)
+	p, err := store.CreateProject(&CreateProjectPayload{Name: "Engine"}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u, p
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store := newTestStore(t)
+
+	u, p := newTestProject(t, store)
+
+	for i := 0; i < 5; i++ {
+		_, err := store.CreateTask(&CreateTaskPayload{Name: "task " + strconv.Itoa(i), Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("should make the creator owner", func(t *testing.T) {
+		member, err := store.GetProjectMember(p.ID, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if member.Role != RoleOwner {
+			t.Errorf("expected role %s, got %s", RoleOwner, member.Role)
+		}
+
+		projects, err := store.GetProjects(u.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(projects) != 1 || projects[0].ID != p.ID {
+			t.Errorf("expected the member to see project %d, got %v", p.ID, projects)
+		}
+	})
+
+	t.Run("should paginate tasks", func(t *testing.T) {
+		filter := &TaskListFilter{Sort: "createdAt", Limit: 2, MemberID: u.ID}
+
+		seen := map[int64]bool{}
+		for {
+			page, err := store.ListTasks(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, task := range page.Tasks {
+				if seen[task.ID] {
+					t.Fatalf("task %d returned twice", task.ID)
+				}
+				seen[task.ID] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			if filter.Cursor, err = decodeCursor(page.NextCursor); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(seen) != 5 {
+			t.Errorf("expected 5 tasks, got %d", len(seen))
+		}
+	})
+
+	t.Run("should save custom workflows", func(t *testing.T) {
+		workflow, err := store.GetWorkflow(p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !workflow.Default {
+			t.Fatal("expected the default workflow")
+		}
+
+		custom := &Workflow{
+			ProjectID: p.ID,
+			States: []*WorkflowState{
+				{Name: StatusTODO, Initial: true},
+				{Name: "BLOCKED"},
+				{Name: StatusDone, Terminal: true},
+			},
+			Transitions: []*WorkflowTransition{
+				{From: StatusTODO, To: "BLOCKED"},
+				{From: "BLOCKED", To: StatusDone},
+			},
+		}
+		if err := store.SaveWorkflow(custom); err != nil {
+			t.Fatal(err)
+		}
+
+		workflow, err = store.GetWorkflow(p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if workflow.Default || len(workflow.States) != 3 || workflow.States[1].Name != "BLOCKED" {
+			t.Errorf("expected the custom workflow, got %+v", workflow)
+		}
+		if !workflow.CanTransition(StatusTODO, "BLOCKED") || workflow.CanTransition(StatusTODO, StatusDone) {
+			t.Errorf("unexpected transitions %+v", workflow.Transitions)
+		}
+
+		_, err = store.CreateTask(&CreateTaskPayload{Name: "blocked", Status: "BLOCKED", ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts, err := store.CountTasksByStatus(p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts[StatusTODO] != 5 || counts["BLOCKED"] != 1 {
+			t.Errorf("unexpected counts %v", counts)
+		}
+	})
+
+	t.Run("should hand the project to a new owner", func(t *testing.T) {
+		grace, err := store.CreateUser(&CreateUserPayload{Email: "grace@example.com", FirstName: "Grace", LastName: "Hopper", Password: "hash"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AddProjectMember(p.ID, grace.ID, RoleMember); err != nil {
+			t.Fatal(err)
+		}
+
+		project, err := store.EditProject(p.ID, &EditProjectPayload{Name: "Engine", Description: "Gears", OwnerID: grace.ID}, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if project.OwnerID != grace.ID || project.Description != "Gears" {
+			t.Errorf("unexpected project %+v", project)
+		}
+
+		member, err := store.GetProjectMember(p.ID, grace.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if member.Role != RoleOwner {
+			t.Errorf("expected role %s, got %s", RoleOwner, member.Role)
+		}
+	})
+
+	t.Run("should hide archived projects", func(t *testing.T) {
+		project, err := store.SetProjectArchived(p.ID, true, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if project.ArchivedAt == nil {
+			t.Fatal("expected the project to be archived")
+		}
+
+		active, err := store.GetProjects(u.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archived, err := store.GetProjects(u.ID, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(active) != 0 || len(archived) != 1 {
+			t.Errorf("expected one archived project, got %d active and %d archived", len(active), len(archived))
+		}
+
+		page, err := store.ListTasks(&TaskListFilter{Sort: "id", Limit: 10, MemberID: u.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Tasks) != 0 {
+			t.Errorf("expected the tasks to be hidden, got %d", len(page.Tasks))
+		}
+
+		if project, err = store.SetProjectArchived(p.ID, false, u.ID); err != nil {
+			t.Fatal(err)
+		}
+		if project.ArchivedAt != nil {
+			t.Error("expected the project to be restored")
+		}
+	})
+
+	t.Run("should cascade project deletion to tasks", func(t *testing.T) {
+		if err := store.DeleteProject(strconv.FormatInt(p.ID, 10), u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		tasks, err := store.GetProjectTasks(p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tasks) != 0 {
+			t.Errorf("expected no tasks, got %d", len(tasks))
+		}
+	})
+}
+
+func TestSQLiteTaskDetails(t *testing.T) {
+	store := newTestStore(t)
+
+	u, p := newTestProject(t, store)
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	estimate := 5
+
+	details := []TaskDetails{
+		{Priority: PriorityLow, DueDate: &day},
+		{Priority: PriorityUrgent},
+		{Priority: PriorityHigh, Description: "**soon**", Estimate: &estimate, DueDate: timePtr(day.AddDate(0, 0, -7))},
+		{Priority: PriorityMedium, DueDate: timePtr(day.AddDate(0, 0, 7)), TimeSpentMinutes: 90},
+	}
+	for i, d := range details {
+		_, err := store.CreateTask(&CreateTaskPayload{Name: "task " + strconv.Itoa(i), Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID, TaskDetails: d}, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(filter *TaskListFilter) []string {
+		filter.MemberID = u.ID
+		names := []string{}
+		for {
+			page, err := store.ListTasks(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, task := range page.Tasks {
+				names = append(names, task.Name)
+			}
+			if page.NextCursor == "" {
+				return names
+			}
+			if filter.Cursor, err = decodeCursor(page.NextCursor); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("should read the details back", func(t *testing.T) {
+		task, err := store.GetTask("3")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if task.Priority != PriorityHigh || task.Description != "**soon**" || task.Estimate == nil || *task.Estimate != 5 || !task.DueDate.Equal(day.AddDate(0, 0, -7)) {
+			t.Errorf("unexpected task %+v", task.TaskDetails)
+		}
+	})
+
+	t.Run("should sort by due date with undated tasks last", func(t *testing.T) {
+		names := list(&TaskListFilter{Sort: "dueDate", Limit: 1})
+		expected := []string{"task 2", "task 0", "task 3", "task 1"}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected %v, got %v", expected, names)
+		}
+	})
+
+	t.Run("should sort by priority", func(t *testing.T) {
+		names := list(&TaskListFilter{Sort: "priority", Desc: true, Limit: 3})
+		expected := []string{"task 1", "task 2", "task 3", "task 0"}
+		if strings.Join(names, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected %v, got %v", expected, names)
+		}
+	})
+
+	t.Run("should filter by priority and due date", func(t *testing.T) {
+		names := list(&TaskListFilter{Sort: "id", Limit: 10, Priorities: []string{PriorityLow, PriorityHigh, PriorityMedium}, DueBefore: &day})
+		if strings.Join(names, ",") != "task 2" {
+			t.Errorf("expected [task 2], got %v", names)
+		}
+	})
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// oidcStateCookie ties the callback to the browser that started the login,
+// so nobody can finish a login they started in someone else's browser.
+const oidcStateCookie = "oidc_state"
+
+// oidcLoginTTL is how long users have to log in at the identity provider.
+const oidcLoginTTL = 10 * time.Minute
+
+// maxUserFieldLength is the size of the email and name columns of users.
+const maxUserFieldLength = 255
+
+// OIDCService logs users in with an OpenID Connect identity provider.
+// Unknown users are created on their first login, and users who registered
+// with a password are linked by their verified email.
+type OIDCService struct {
+	store    Store
+	provider *OIDCProvider
+	users    *UserService
+}
+
+func NewOIDCService(s Store, provider *OIDCProvider, users *UserService) *OIDCService {
+	return &OIDCService{store: s, provider: provider, users: users}
+}
+
+func (s *OIDCService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/auth/oidc/login", s.handleLogin).Methods("GET")
+	r.HandleFunc("/auth/oidc/callback", s.handleCallback).Methods("GET")
+}
+
+// handleLogin redirects to the identity provider. The state, nonce and PKCE
+// verifier of the login are kept until the callback uses them.
+func (s *OIDCService) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := newOpaqueToken()
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while starting the login"})
+			return
+		}
+		secrets[i] = secret
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := s.provider.AuthCodeURL(state, nonce, pkceChallenge(verifier))
+	if err != nil {
+		log.Printf("reaching the identity provider failed: %v", err)
+		WriteJSON(w, http.StatusBadGateway, ErrorResponse{Error: errOIDCUnavailable.Error()})
+		return
+	}
+
+	err = s.store.CreateOIDCLogin(&OIDCLogin{
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while starting the login"})
+		return
+	}
+
+	setOIDCStateCookie(w, r, state, int(oidcLoginTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleCallback finishes the login like handleUserLogin does: with a 2FA
+// challenge when the user needs one, or with the tokens.
+func (s *OIDCService) handleCallback(w http.ResponseWriter, r *http.Request) {
+	// the state is good for one callback whatever happens
+	setOIDCStateCookie(w, r, "", -1)
+
+	q := r.URL.Query()
+
+	if e := q.Get("error"); e != "" {
+		WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "the identity provider refused the login: " + e})
+		return
+	}
+
+	state, code := q.Get("state"), q.Get("code")
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || code == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidOIDCState.Error()})
+		return
+	}
+
+	login, err := s.store.ConsumeOIDCLogin(hashToken(state))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidOIDCState.Error()})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while logging in"})
+		return
+	}
+
+	idToken, err := s.provider.Exchange(code, login.CodeVerifier)
+	if err != nil {
+		log.Printf("exchanging the authorization code failed: %v", err)
+		WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Error: errOIDCLoginFailed.Error()})
+		return
+	}
+
+	claims, err := s.provider.VerifyIDToken(idToken, login.Nonce)
+	if err != nil {
+		log.Printf("verifying the ID token failed: %v", err)
+		WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Error: errOIDCLoginFailed.Error()})
+		return
+	}
+
+	user, status, err := s.resolveUser(claims)
+	if status == http.StatusInternalServerError {
+		log.Printf("resolving the user of %s at %s failed: %v", claims.Subject, claims.Issuer, err)
+		WriteJSON(w, status, ErrorResponse{Error: "Error while logging in"})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, status, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if user.TwoFactorEnabledAt != nil || Envs.TwoFactorRequired {
+		s.users.startTwoFactorLogin(w, user)
+		return
+	}
+
+	tokens, err := createAndSetAuthCookie(s.store, user.ID, "", w)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while logging in"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tokens)
+}
+
+// resolveUser finds the user linked to the subject of the claims. Without a
+// link, the verified email of the claims links the user who has it, or
+// creates one. The status is the one to answer with when err is not nil.
+func (s *OIDCService) resolveUser(claims *IDTokenClaims) (*User, int, error) {
+	user, status, err := s.linkUser(claims)
+
+	// a concurrent login of the same subject or email got there first, what
+	// it created is found this time
+	if isDuplicateKey(err) {
+		user, status, err = s.linkUser(claims)
+	}
+
+	return user, status, err
+}
+
+func (s *OIDCService) linkUser(claims *IDTokenClaims) (*User, int, error) {
+	identity, err := s.store.GetUserIdentity(claims.Issuer, claims.Subject)
+	if err == nil {
+		user, err := s.store.GetUserByID(strconv.FormatInt(identity.UserID, 10))
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return user, 0, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, http.StatusForbidden, errOIDCEmailNotVerified
+	}
+
+	if err := validateOIDCClaims(claims); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	identity = &UserIdentity{Issuer: claims.Issuer, Subject: claims.Subject, Email: claims.Email}
+
+	user, err := s.store.GetUserByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// whoever registered an email they never verified may not own it,
+		// linking would hand them the account of the real owner or the
+		// other way around
+		if user.EmailVerifiedAt == nil {
+			return nil, http.StatusConflict, errOIDCUnverifiedAccount
+		}
+
+		identity.UserID = user.ID
+		if err := s.store.CreateUserIdentity(identity); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = s.provisionUser(claims, identity)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	default:
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return user, 0, nil
+}
+
+// provisionUser creates the user of a first login, linked to identity. The
+// password is random, users who want one set it with the password reset.
+func (s *OIDCService) provisionUser(claims *IDTokenClaims, identity *UserIdentity) (*User, error) {
+	password, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	firstName, lastName := oidcNames(claims)
+
+	return s.store.CreateUserWithIdentity(&CreateUserPayload{Email: claims.Email, FirstName: firstName, LastName: lastName, Password: hash}, time.Now(), identity)
+}
+
+// validateOIDCClaims checks the email and names the user of a first login is
+// created with.
+func validateOIDCClaims(claims *IDTokenClaims) error {
+	email, err := mail.ParseAddress(claims.Email)
+	if err != nil || email.Address != claims.Email || utf8.RuneCountInString(claims.Email) > maxUserFieldLength {
+		return errInvalidEmail
+	}
+
+	firstName, lastName := oidcNames(claims)
+	if strings.TrimSpace(firstName) == "" {
+		return errFirstNameRequired
+	}
+	if utf8.RuneCountInString(firstName) > maxUserFieldLength || utf8.RuneCountInString(lastName) > maxUserFieldLength {
+		return errNameTooLong
+	}
+
+	return nil
+}
+
+// oidcNames prefers the given and family names, then splits the full name,
+// then falls back to the local part of the email.
+func oidcNames(claims *IDTokenClaims) (string, string) {
+	if claims.GivenName != "" {
+		return claims.GivenName, claims.FamilyName
+	}
+
+	if name := strings.TrimSpace(claims.Name); name != "" {
+		first, last, _ := strings.Cut(name, " ")
+		return first, strings.TrimSpace(last)
+	}
+
+	local, _, _ := strings.Cut(claims.Email, "@")
+	return local, ""
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, r *http.Request, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(Envs.AppURL, "https://"),
+		// Lax still sends the cookie on the redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+}
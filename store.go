@@ -1,22 +1,127 @@
 package main
 
-import "database/sql"
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	sqlite3 "modernc.org/sqlite/lib"
+)
 
 type Store interface {
 	// Users
 	CreateUser(u *CreateUserPayload) (*User, error)
 	GetUserByID(id string) (*User, error)
 	GetUserByEmail(email string) (*User, error)
+	ListUsers(query string, afterID int64, limit int) ([]*User, error)
+	UpdateUserProfile(id int64, firstName, lastName string) error
+	UpdateUserEmail(id int64, email string) error
+	UpdateUserPassword(id int64, password string) error
+	DeleteUser(id int64) error
+	MarkEmailVerified(id int64, at time.Time) error
+	//User tokens
+	CreateUserToken(t *UserToken) error
+	GetUserToken(hash, purpose string) (*UserToken, error)
+	ConsumeUserToken(hash, purpose string) (*UserToken, error)
+	//Two-factor
+	SetTOTPSecret(userID int64, secret string) error
+	EnableTOTP(userID, step int64, codeHashes []string) error
+	DisableTOTP(userID int64) error
+	UseTOTPStep(userID, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID int64, codeHashes []string) error
+	UseRecoveryCode(userID int64, hash string) (bool, error)
+	//Refresh tokens
+	CreateRefreshToken(t *RefreshToken) error
+	GetRefreshTokenByHash(hash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(id string) (bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	//Login throttling
+	GetLoginLock(kind, subject string) (time.Time, error)
+	RecordLoginFailure(kind, subject string, at time.Time, window time.Duration) (int, error)
+	LockLogin(l *Lockout) error
+	ClearLoginFailures(kind, subject string) error
+	ListLockouts(activeOnly bool, beforeID int64, limit int) ([]*Lockout, error)
+	ClearLockout(id, adminID int64) (*Lockout, error)
+	//Mail throttling
+	RecordMailRequest(kind, subject string, at time.Time, window time.Duration) (int, error)
+	//Personal access tokens
+	CreateAccessToken(t *AccessToken) error
+	GetAccessTokenByHash(hash string) (*AccessToken, error)
+	ListAccessTokens(userID int64) ([]*AccessToken, error)
+	RevokeAccessToken(userID, id int64) error
+	TouchAccessToken(id int64, at time.Time) error
+	//Single sign-on
+	CreateOIDCLogin(l *OIDCLogin) error
+	ConsumeOIDCLogin(stateHash string) (*OIDCLogin, error)
+	GetUserIdentity(issuer, subject string) (*UserIdentity, error)
+	CreateUserIdentity(i *UserIdentity) error
+	CreateUserWithIdentity(u *CreateUserPayload, verifiedAt time.Time, i *UserIdentity) (*User, error)
+	//Token revocation
+	TokenRevoker
+	RevokeUserTokens(userID int64, at time.Time) error
 	//Project
-	CreateProject(p *CreateProjectPayload) (*Project, error)
+	CreateProject(p *CreateProjectPayload, ownerID int64) (*Project, error)
 	GetProject(id string) (*Project, error)
-	GetProjects() ([]*Project, error)
-	DeleteProject(id string) error
+	GetProjects(userID int64, archived bool) ([]*Project, error)
+	EditProject(id int64, p *EditProjectPayload, actorID int64) (*Project, error)
+	SetProjectArchived(id int64, archived bool, actorID int64) (*Project, error)
+	DeleteProject(id string, actorID int64) error
+	PurgeProject(id int64) error
+	//Members
+	AddProjectMember(projectID, userID int64, role string) (*ProjectMember, error)
+	GetProjectMember(projectID, userID int64) (*ProjectMember, error)
+	GetProjectMembers(projectID int64) ([]*ProjectMember, error)
+	UpdateProjectMemberRole(projectID, userID int64, role string) error
+	RemoveProjectMember(projectID, userID int64) error
 	//Tasks
-	CreateTask(t *CreateTaskPayload) (*Task, error)
+	CreateTask(t *CreateTaskPayload, createdByID int64) (*Task, error)
 	GetTask(id string) (*Task, error)
-	DeleteTask(id string) error
-	EditTask(id string, t *EditTaskPayload) (*Task, error)
+	ListTasks(f *TaskListFilter) (*TaskPage, error)
+	GetProjectTasks(projectID int64) ([]*Task, error)
+	DeleteTask(id string, actorID int64) error
+	EditTask(id string, t *EditTaskPayload, from string, version int64, actorID int64) (*Task, error)
+	//Trash
+	ListTrash(userID int64) ([]*TrashItem, error)
+	GetDeletedTask(id int64) (*Task, error)
+	GetDeletedProject(id int64) (*Project, error)
+	RestoreTask(id int64, status string, actorID int64) (*Task, error)
+	RestoreProject(id int64, actorID int64) (*Project, error)
+	PurgeTrash(before time.Time) (int64, error)
+	//Subtasks and dependencies
+	SetTaskParent(taskID, parentID int64, actorID int64) (*Task, error)
+	GetSubtasks(taskID int64) ([]*Task, error)
+	AddTaskDependency(blockerID, blockedID int64, actorID int64) error
+	RemoveTaskDependency(blockerID, blockedID int64, actorID int64) error
+	GetTaskBlockers(taskID int64) ([]*Task, error)
+	GetBlockedTasks(taskID int64) ([]*Task, error)
+	//Labels
+	CreateLabel(projectID int64, l *LabelPayload) (*Label, error)
+	GetLabel(id int64) (*Label, error)
+	GetProjectLabels(projectID int64) ([]*Label, error)
+	DeleteLabel(id int64) error
+	AddTaskLabel(taskID, labelID int64, actorID int64) error
+	RemoveTaskLabel(taskID, labelID int64, actorID int64) error
+	GetTaskLabels(taskID int64) ([]*Label, error)
+	//Comments
+	CreateComment(taskID, authorID int64, body string) (*Comment, error)
+	GetComment(id int64) (*Comment, error)
+	ListComments(taskID int64, afterID int64, limit int) ([]*Comment, error)
+	UpdateComment(id int64, body string) (*Comment, error)
+	DeleteComment(id int64) error
+	//Workflows
+	GetWorkflow(projectID int64) (*Workflow, error)
+	SaveWorkflow(w *Workflow) error
+	DeleteWorkflow(projectID int64) error
+	CountTasksByStatus(projectID int64) (map[string]int, error)
+	//Audit trail
+	ListEvents(f *EventFilter) ([]*Event, error)
+	//Search
+	SearchDocuments(projectID int64) ([]*SearchDocument, error)
 }
 
 type Storage struct {
@@ -52,18 +157,132 @@ func (s *Storage) CreateUser(userPayload *CreateUserPayload) (*User, error) {
 
 func (s *Storage) GetUserByID(id string) (*User, error) {
 	var u User
-	err := s.db.QueryRow("SELECT id, email, firstName, lastName, createdAt FROM users WHERE id = ?", id).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.CreatedAt)
+	err := s.db.QueryRow("SELECT id, email, firstName, lastName, role, tokensRevokedAt, emailVerifiedAt, COALESCE(totpSecret, ''), totpEnabledAt, createdAt FROM users WHERE id = ?", id).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Role, &u.TokensRevokedAt, &u.EmailVerifiedAt, &u.TOTPSecret, &u.TwoFactorEnabledAt, &u.CreatedAt)
 	return &u, err
 }
 
 func (s *Storage) GetUserByEmail(email string) (*User, error) {
 	var u User
-	err := s.db.QueryRow("SELECT id, email, firstName, lastName, password, createdAt FROM users WHERE email = ?", email).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Password, &u.CreatedAt)
+	err := s.db.QueryRow("SELECT id, email, firstName, lastName, password, role, emailVerifiedAt, COALESCE(totpSecret, ''), totpEnabledAt, createdAt FROM users WHERE email = ?", email).Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Password, &u.Role, &u.EmailVerifiedAt, &u.TOTPSecret, &u.TwoFactorEnabledAt, &u.CreatedAt)
 	return &u, err
 }
 
-func (s *Storage) CreateTask(taskPayload *CreateTaskPayload) (*Task, error) {
-	rows, err := s.db.Exec("INSERT INTO tasks (name, status, projectId, assignedToId) VALUES (?, ?, ?, ?)", taskPayload.Name, taskPayload.Status, taskPayload.ProjectID, taskPayload.AssignedToID)
+// ListUsers returns the users after afterID whose name or email contains
+// every word of query, ignoring case.
+func (s *Storage) ListUsers(query string, afterID int64, limit int) ([]*User, error) {
+	where := []string{"id > ?"}
+	args := []any{afterID}
+
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		where = append(where, "(LOWER(firstName) LIKE ? ESCAPE '!' OR LOWER(lastName) LIKE ? ESCAPE '!' OR LOWER(email) LIKE ? ESCAPE '!')")
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	args = append(args, limit)
+	rows, err := s.db.Query("SELECT id, email, firstName, lastName, role, createdAt FROM users WHERE "+strings.Join(where, " AND ")+" ORDER BY id LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Role, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, &u)
+	}
+
+	return users, rows.Err()
+}
+
+// likeEscaper escapes the LIKE wildcards of user input, for ESCAPE '!'.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (s *Storage) UpdateUserProfile(id int64, firstName, lastName string) error {
+	_, err := s.db.Exec("UPDATE users SET firstName = ?, lastName = ? WHERE id = ?", firstName, lastName, id)
+	return err
+}
+
+// UpdateUserEmail changes the email of the user, who has to verify the new
+// address again.
+func (s *Storage) UpdateUserEmail(id int64, email string) error {
+	// MySQL assigns left to right, emailVerifiedAt has to see the old email
+	_, err := s.db.Exec("UPDATE users SET emailVerifiedAt = CASE WHEN email = ? THEN emailVerifiedAt END, email = ? WHERE id = ?", email, email, id)
+	return err
+}
+
+func (s *Storage) MarkEmailVerified(id int64, at time.Time) error {
+	_, err := s.db.Exec("UPDATE users SET emailVerifiedAt = ? WHERE id = ? AND emailVerifiedAt IS NULL", sqlTime(at), id)
+	return err
+}
+
+func (s *Storage) UpdateUserPassword(id int64, password string) error {
+	_, err := s.db.Exec("UPDATE users SET password = ? WHERE id = ?", password, id)
+	return err
+}
+
+// DeleteUser removes the account. Projects the user is the only owner of
+// must be handed over first, errSoleOwner is returned otherwise, except for
+// projects in the trash which are purged. Tasks assigned to the user go to
+// the owner of their project.
+func (s *Storage) DeleteUser(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	soleOwner := "SELECT projectId FROM project_members WHERE userId = ? AND role = ? AND projectId NOT IN " +
+		"(SELECT projectId FROM project_members WHERE role = ? AND userId <> ?)"
+
+	var owned int
+	err = tx.QueryRow("SELECT COUNT(*) FROM projects WHERE deletedAt IS NULL AND id IN ("+soleOwner+")", id, RoleOwner, RoleOwner, id).Scan(&owned)
+	if err != nil {
+		return err
+	}
+	if owned > 0 {
+		return errSoleOwner
+	}
+
+	// MySQL only reads the table it deletes from through a derived table
+	_, err = tx.Exec("DELETE FROM projects WHERE id IN (SELECT projectId FROM ("+soleOwner+") AS owned)", id, RoleOwner, RoleOwner, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE projects SET ownerId = (SELECT MIN(userId) FROM project_members m WHERE m.projectId = projects.id AND m.role = ? AND m.userId <> ?) WHERE ownerId = ?", RoleOwner, id, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE tasks SET assignedToId = COALESCE((SELECT ownerId FROM projects p WHERE p.id = tasks.projectId), "+
+		"(SELECT MIN(userId) FROM project_members m WHERE m.projectId = tasks.projectId AND m.role = ? AND m.userId <> ?)) WHERE assignedToId = ?", RoleOwner, id, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) CreateTask(taskPayload *CreateTaskPayload, createdByID int64) (*Task, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	d := taskPayload.TaskDetails
+	rows, err := tx.Exec("INSERT INTO tasks (name, status, projectId, assignedToId, createdById, parentId, description, priority, startDate, dueDate, estimate, timeSpentMinutes) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		taskPayload.Name, taskPayload.Status, taskPayload.ProjectID, taskPayload.AssignedToID, createdByID, nullID(taskPayload.ParentID), d.Description, priorityRank(d.Priority), nullTime(d.StartDate), nullTime(d.DueDate), d.Estimate, d.TimeSpentMinutes)
 
 	if err != nil {
 		return nil, err
@@ -80,27 +299,331 @@ func (s *Storage) CreateTask(taskPayload *CreateTaskPayload) (*Task, error) {
 		Status:       taskPayload.Status,
 		ProjectID:    taskPayload.ProjectID,
 		AssignedToID: taskPayload.AssignedToID,
+		CreatedByID:  createdByID,
+		ParentID:     taskPayload.ParentID,
+		Version:      1,
+		TaskDetails:  d,
+	}
+
+	err = insertTaskEvent(tx, createdByID, ActionCreated, nil, task)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
+
 	return task, nil
 }
 
-func (s *Storage) GetTask(id string) (*Task, error) {
+// taskColumns lists the task columns in the order scanTask reads them.
+const taskColumns = "id, name, status, projectId, assignedToId, COALESCE(createdById, 0), COALESCE(parentId, 0), version, createdAt, " +
+	"COALESCE(description, ''), priority, startDate, dueDate, estimate, timeSpentMinutes"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTask(row scanner) (*Task, error) {
 	var t Task
-	err := s.db.QueryRow("SELECT id, name, status, projectId, assignedToId, createdAt FROM tasks WHERE id = ?", id).Scan(&t.ID, &t.Name, &t.Status, &t.ProjectID, &t.AssignedToID, &t.CreatedAt)
+	var priority int
+	err := row.Scan(&t.ID, &t.Name, &t.Status, &t.ProjectID, &t.AssignedToID, &t.CreatedByID, &t.ParentID, &t.Version, &t.CreatedAt,
+		&t.Description, &priority, &t.StartDate, &t.DueDate, &t.Estimate, &t.TimeSpentMinutes)
+	t.Priority = priorityName(priority)
 	return &t, err
 }
 
-func (s *Storage) DeleteTask(id string) error {
-	_, err := s.db.Exec("DELETE FROM tasks WHERE id = ?", id)
+// liveTasks keeps trashed tasks, and the tasks of trashed projects, out of
+// task queries. Its columns are unqualified so it also fits queries joining
+// comments.
+const liveTasks = "deletedAt IS NULL AND projectId NOT IN (SELECT id FROM projects WHERE deletedAt IS NOT NULL)"
+
+func (s *Storage) GetTask(id string) (*Task, error) {
+	return scanTask(s.db.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ? AND "+liveTasks, id))
+}
+
+func (s *Storage) GetProjectTasks(projectID int64) ([]*Task, error) {
+	return s.queryTasks("SELECT "+taskColumns+" FROM tasks WHERE projectId = ? AND "+liveTasks+" ORDER BY createdAt, id", projectID)
+}
+
+// taskSortColumns maps the sort values accepted by the API to task columns.
+// Nullable columns sort on a sentinel so empty values come last and the
+// keyset condition never compares with NULL.
+var taskSortColumns = map[string]string{
+	"createdAt": "createdAt",
+	"name":      "name",
+	"id":        "id",
+	"priority":  "priority",
+	"startDate": "COALESCE(startDate, '" + noDate + "')",
+	"dueDate":   "COALESCE(dueDate, '" + noDate + "')",
+	"estimate":  "COALESCE(estimate, " + strconv.Itoa(noEstimate) + ")",
+}
+
+const (
+	noDate     = "9999-12-31 23:59:59"
+	noEstimate = 1 << 30
+)
+
+func (s *Storage) ListTasks(f *TaskListFilter) (*TaskPage, error) {
+	column, ok := taskSortColumns[f.Sort]
+	if !ok {
+		return nil, errInvalidSort
+	}
+
+	where := []string{liveTasks}
+	var args []any
+
+	if len(f.Statuses) > 0 {
+		where = append(where, "status IN (?"+strings.Repeat(", ?", len(f.Statuses)-1)+")")
+		for _, status := range f.Statuses {
+			args = append(args, status)
+		}
+	}
+
+	if f.ProjectID != 0 {
+		where = append(where, "projectId = ?")
+		args = append(args, f.ProjectID)
+	}
+
+	if f.MemberID != 0 {
+		// tasks of archived projects are hidden along with their project
+		where = append(where, "projectId IN (SELECT m.projectId FROM project_members m JOIN projects p ON p.id = m.projectId WHERE m.userId = ? AND p.archivedAt IS NULL)")
+		args = append(args, f.MemberID)
+	}
+
+	if f.AssignedToID != 0 {
+		where = append(where, "assignedToId = ?")
+		args = append(args, f.AssignedToID)
+	}
+
+	if f.CreatedAfter != nil {
+		where = append(where, "createdAt >= ?")
+		args = append(args, sqlTime(*f.CreatedAfter))
+	}
+
+	if f.CreatedBefore != nil {
+		where = append(where, "createdAt < ?")
+		args = append(args, sqlTime(*f.CreatedBefore))
+	}
+
+	if len(f.Priorities) > 0 {
+		where = append(where, "priority IN (?"+strings.Repeat(", ?", len(f.Priorities)-1)+")")
+		for _, priority := range f.Priorities {
+			args = append(args, priorityRank(priority))
+		}
+	}
+
+	if len(f.LabelsAny) > 0 {
+		where = append(where, "id IN (SELECT taskId FROM task_labels WHERE labelId IN (?"+strings.Repeat(", ?", len(f.LabelsAny)-1)+"))")
+		for _, id := range f.LabelsAny {
+			args = append(args, id)
+		}
+	}
+
+	if len(f.LabelsAll) > 0 {
+		where = append(where, "id IN (SELECT taskId FROM task_labels WHERE labelId IN (?"+strings.Repeat(", ?", len(f.LabelsAll)-1)+") GROUP BY taskId HAVING COUNT(*) = ?)")
+		for _, id := range f.LabelsAll {
+			args = append(args, id)
+		}
+		args = append(args, len(f.LabelsAll))
+	}
+
+	if len(f.LabelsNone) > 0 {
+		where = append(where, "id NOT IN (SELECT taskId FROM task_labels WHERE labelId IN (?"+strings.Repeat(", ?", len(f.LabelsNone)-1)+"))")
+		for _, id := range f.LabelsNone {
+			args = append(args, id)
+		}
+	}
+
+	if f.DueAfter != nil {
+		where = append(where, "dueDate >= ?")
+		args = append(args, sqlTime(*f.DueAfter))
+	}
+
+	if f.DueBefore != nil {
+		where = append(where, "dueDate < ?")
+		args = append(args, sqlTime(*f.DueBefore))
+	}
+
+	op, dir := ">", "ASC"
+	if f.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if f.Cursor != nil {
+		if column == "id" {
+			where = append(where, "id "+op+" ?")
+			args = append(args, f.Cursor.ID)
+		} else {
+			value, err := cursorValue(f.Sort, f.Cursor.Value)
+			if err != nil {
+				return nil, err
+			}
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, op))
+			args = append(args, value, value, f.Cursor.ID)
+		}
+	}
+
+	query := "SELECT " + taskColumns + " FROM tasks WHERE " + strings.Join(where, " AND ")
+	if column == "id" {
+		query += " ORDER BY id " + dir
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, id %s", column, dir, dir)
+	}
+	// fetch one extra row to know whether there is a next page
+	query += " LIMIT " + strconv.Itoa(f.Limit+1)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &TaskPage{Tasks: []*Task{}}
+
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Tasks = append(page.Tasks, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Tasks) > f.Limit {
+		page.Tasks = page.Tasks[:f.Limit]
+		last := page.Tasks[len(page.Tasks)-1]
+		page.NextCursor = encodeCursor(cursor{Value: taskSortValue(f.Sort, last), ID: last.ID, Sort: f.Sort, Desc: f.Desc})
+	}
+
+	return page, nil
+}
+
+func taskSortValue(sort string, t *Task) string {
+	switch sort {
+	case "createdAt":
+		return t.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "name":
+		return t.Name
+	case "priority":
+		return strconv.Itoa(priorityRank(t.Priority))
+	case "startDate", "dueDate":
+		d := t.StartDate
+		if sort == "dueDate" {
+			d = t.DueDate
+		}
+		if d == nil {
+			return noDate
+		}
+		return sqlTime(*d)
+	case "estimate":
+		if t.Estimate == nil {
+			return strconv.Itoa(noEstimate)
+		}
+		return strconv.Itoa(*t.Estimate)
+	}
+
+	return ""
+}
+
+func cursorValue(sort, value string) (any, error) {
+	switch sort {
+	case "createdAt":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+		return sqlTime(t), nil
+	case "startDate", "dueDate":
+		if _, err := time.Parse("2006-01-02 15:04:05", value); err != nil {
+			return nil, errInvalidCursor
+		}
+	case "priority", "estimate":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+		return n, nil
+	}
+
+	return value, nil
+}
+
+// nullTime stores a nil time as NULL.
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+
+	return sqlTime(*t)
+}
+
+// sqlTime formats t the way both MySQL and SQLite store TIMESTAMP columns so
+// comparisons behave the same on every backend. It writes UTC, which is why
+// the MySQL session time zone is set to UTC in main.go.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// isDuplicateKey tells whether err is the violation of a unique or primary
+// key, for the writes that race with another request inserting the same row.
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062 // ER_DUP_ENTRY
+	}
+
+	var sqliteErr interface{ Code() int }
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+
+	return false
+}
+
+// DeleteTask moves the task to the trash. Its subtasks keep it as their parent,
+// so they are under it again once it is restored, and move to the top level
+// when it is purged.
+func (s *Storage) DeleteTask(id string, actorID int64) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	task, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ?", id))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE tasks SET deletedAt = ?, deletedById = ? WHERE id = ?", sqlTime(time.Now()), nullID(actorID), id)
+	if err != nil {
+		return err
+	}
+
+	err = insertTaskEvent(tx, actorID, ActionDeleted, task, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (s *Storage) CreateProject(p *CreateProjectPayload) (*Project, error) {
-	rows, err := s.db.Exec("INSERT INTO projects (name) VALUES (?)", p.Name)
+// CreateProject inserts the project and makes ownerID its owner in a single
+// transaction, so a project never exists without an owner.
+func (s *Storage) CreateProject(p *CreateProjectPayload, ownerID int64) (*Project, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Exec("INSERT INTO projects (name, description, createdById, ownerId) VALUES (?, ?, ?, ?)", p.Name, p.Description, ownerID, ownerID)
 
 	if err != nil {
 		return nil, err
@@ -111,23 +634,53 @@ func (s *Storage) CreateProject(p *CreateProjectPayload) (*Project, error) {
 		return nil, err
 	}
 
+	_, err = tx.Exec("INSERT INTO project_members (projectId, userId, role) VALUES (?, ?, ?)", id, ownerID, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
 	project := &Project{
-		ID:   id,
-		Name: p.Name,
+		ID:          id,
+		Name:        p.Name,
+		Description: p.Description,
+		OwnerID:     ownerID,
+		CreatedByID: ownerID,
+	}
+
+	err = insertProjectEvent(tx, ownerID, ActionCreated, nil, project)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	project.ID = id
 	return project, nil
 }
 
-func (s *Storage) GetProject(id string) (*Project, error) {
+// projectColumns lists the project columns in the order scanProject reads them.
+const projectColumns = "id, name, COALESCE(description, ''), COALESCE(ownerId, 0), COALESCE(createdById, 0), createdAt, archivedAt"
+
+func scanProject(row scanner) (*Project, error) {
 	var p Project
-	err := s.db.QueryRow("SELECT id, name, createdAt FROM projects WHERE id = ?", id).Scan(&p.ID, &p.Name, &p.CreatedAt)
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &p.OwnerID, &p.CreatedByID, &p.CreatedAt, &p.ArchivedAt)
 	return &p, err
 }
 
-func (s *Storage) GetProjects() ([]*Project, error) {
-	rows, err := s.db.Query("SELECT id, name, createdAt FROM projects")
+func (s *Storage) GetProject(id string) (*Project, error) {
+	return scanProject(s.db.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ? AND deletedAt IS NULL", id))
+}
+
+// GetProjects returns the projects the user is a member of, either the active
+// or the archived ones.
+func (s *Storage) GetProjects(userID int64, archived bool) ([]*Project, error) {
+	condition := "archivedAt IS NULL"
+	if archived {
+		condition = "archivedAt IS NOT NULL"
+	}
+
+	rows, err := s.db.Query("SELECT "+projectColumns+" FROM projects WHERE id IN (SELECT projectId FROM project_members WHERE userId = ?) AND deletedAt IS NULL AND "+condition+" ORDER BY id", userID)
 	if err != nil {
 		return nil, err
 	}
@@ -136,14 +689,11 @@ func (s *Storage) GetProjects() ([]*Project, error) {
 	projects := []*Project{}
 
 	for rows.Next() {
-		// p := new(Project)
-		var p Project
-		err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt)
+		p, err := scanProject(rows)
 		if err != nil {
 			return nil, err
 		}
-		// projects = append(projects, p)
-		projects = append(projects, &p)
+		projects = append(projects, p)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -153,33 +703,1588 @@ func (s *Storage) GetProjects() ([]*Project, error) {
 	return projects, nil
 }
 
-func (s *Storage) DeleteProject(id string) error {
-	_, err := s.db.Exec("DELETE FROM projects WHERE id = ?", id)
+// EditProject updates the project and records the changes in the audit
+// trail. A new owner is given the owner role if they did not have it yet.
+func (s *Storage) EditProject(id int64, p *EditProjectPayload, actorID int64) (*Project, error) {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	return nil
+	before, err := scanProject(tx.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE projects SET name = ?, description = ?, ownerId = ? WHERE id = ?", p.Name, p.Description, nullID(p.OwnerID), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.OwnerID != before.OwnerID {
+		_, err = tx.Exec("UPDATE project_members SET role = ? WHERE projectId = ? AND userId = ?", RoleOwner, id, p.OwnerID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := scanProject(tx.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertProjectEvent(tx, actorID, ActionUpdated, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return after, nil
 }
 
-func (s *Storage) EditTask(id string, t *EditTaskPayload) (*Task, error) {
-	query := "UPDATE tasks SET name = ?, status = ?, AssignedToID = ? WHERE id = ?"
+// SetProjectArchived archives or restores the project.
+func (s *Storage) SetProjectArchived(id int64, archived bool, actorID int64) (*Project, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := scanProject(tx.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	action, archivedAt := ActionRestored, any(nil)
+	if archived {
+		action, archivedAt = ActionArchived, sqlTime(time.Now())
+	}
+
+	_, err = tx.Exec("UPDATE projects SET archivedAt = ? WHERE id = ?", archivedAt, id)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := s.db.Exec(query, t.Name, t.Status, t.AssignedToID, id)
+	after, err := scanProject(tx.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
 	if err != nil {
 		return nil, err
 	}
 
-	var updatedTask Task
-	err = s.db.QueryRow("SELECT id, name, status, AssignedToID, createdAt FROM tasks WHERE id = ?", id).Scan(
-		&updatedTask.ID,
-		&updatedTask.Name,
-		&updatedTask.Status,
-		&updatedTask.AssignedToID,
-		&updatedTask.CreatedAt)
+	err = insertProjectEvent(tx, actorID, action, before, after)
 	if err != nil {
 		return nil, err
 	}
 
-	return &updatedTask, nil
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+// DeleteProject moves the project to the trash, which hides its tasks too.
+func (s *Storage) DeleteProject(id string, actorID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	project, err := scanProject(tx.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE projects SET deletedAt = ?, deletedById = ? WHERE id = ?", sqlTime(time.Now()), nullID(actorID), id)
+	if err != nil {
+		return err
+	}
+
+	err = insertProjectEvent(tx, actorID, ActionDeleted, project, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeProject removes the project with its tasks for good.
+func (s *Storage) PurgeProject(id int64) error {
+	_, err := s.db.Exec("DELETE FROM projects WHERE id = ?", id)
+	return err
+}
+
+// ListTrash returns the deleted tasks and projects of the projects userID is
+// a member of, most recently deleted first.
+func (s *Storage) ListTrash(userID int64) ([]*TrashItem, error) {
+	rows, err := s.db.Query(
+		"SELECT 'project', id, id, name, deletedAt, COALESCE(deletedById, 0) FROM projects "+
+			"WHERE deletedAt IS NOT NULL AND id IN (SELECT projectId FROM project_members WHERE userId = ?) "+
+			"UNION ALL SELECT 'task', id, projectId, name, deletedAt, COALESCE(deletedById, 0) FROM tasks "+
+			"WHERE deletedAt IS NOT NULL AND projectId IN (SELECT projectId FROM project_members WHERE userId = ?) "+
+			"ORDER BY 5 DESC, 2 DESC", userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*TrashItem{}
+
+	for rows.Next() {
+		var item TrashItem
+		if err := rows.Scan(&item.Type, &item.ID, &item.ProjectID, &item.Name, &item.DeletedAt, &item.DeletedByID); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+func (s *Storage) GetDeletedTask(id int64) (*Task, error) {
+	return scanTask(s.db.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ? AND deletedAt IS NOT NULL", id))
+}
+
+func (s *Storage) GetDeletedProject(id int64) (*Project, error) {
+	return scanProject(s.db.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ? AND deletedAt IS NOT NULL", id))
+}
+
+// RestoreTask takes the task out of the trash in the given status, which
+// differs from its old one when the workflow changed in the meantime.
+func (s *Storage) RestoreTask(id int64, status string, actorID int64) (*Task, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE tasks SET deletedAt = NULL, deletedById = NULL, status = ?, version = version + 1 WHERE id = ?", status, id)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertTaskEvent(tx, actorID, ActionRestored, nil, task)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return task, nil
+}
+
+func (s *Storage) RestoreProject(id int64, actorID int64) (*Project, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE projects SET deletedAt = NULL, deletedById = NULL WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := scanProject(tx.QueryRow("SELECT "+projectColumns+" FROM projects WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertProjectEvent(tx, actorID, ActionRestored, nil, project)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+// PurgeTrash removes the tasks and projects deleted before the given time for
+// good and returns how many were removed.
+func (s *Storage) PurgeTrash(before time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	projects, err := tx.Exec("DELETE FROM projects WHERE deletedAt < ?", sqlTime(before))
+	if err != nil {
+		return 0, err
+	}
+
+	tasks, err := tx.Exec("DELETE FROM tasks WHERE deletedAt < ?", sqlTime(before))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	p, err := projects.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	t, err := tasks.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return p + t, nil
+}
+
+// EditTask updates the task and records the changed fields in the audit
+// trail in the same transaction. The task is only updated if it is still in
+// the from status, the one its transition was checked against, otherwise
+// errStatusChanged is returned. When version is not zero it also has to be
+// still at that version, otherwise errVersionConflict is returned.
+func (s *Storage) EditTask(id string, t *EditTaskPayload, from string, version int64, actorID int64) (*Task, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 0 && before.Version != version {
+		return nil, errVersionConflict
+	}
+
+	if before.Status != from {
+		return nil, errStatusChanged
+	}
+
+	query := "UPDATE tasks SET name = ?, status = ?, AssignedToID = ?, description = ?, priority = ?, startDate = ?, dueDate = ?, estimate = ?, timeSpentMinutes = ?, version = version + 1 WHERE id = ? AND version = ? AND status = ?"
+
+	d := t.TaskDetails
+	res, err := tx.Exec(query, t.Name, t.Status, t.AssignedToID, d.Description, priorityRank(d.Priority), nullTime(d.StartDate), nullTime(d.DueDate), d.Estimate, d.TimeSpentMinutes, id, before.Version, from)
+	if err != nil {
+		return nil, err
+	}
+
+	// another writer got in between the read and the update
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, errVersionConflict
+	}
+
+	updatedTask, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertTaskEvent(tx, actorID, ActionUpdated, before, updatedTask)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return updatedTask, nil
+}
+
+func (s *Storage) AddProjectMember(projectID, userID int64, role string) (*ProjectMember, error) {
+	_, err := s.db.Exec("INSERT INTO project_members (projectId, userId, role) VALUES (?, ?, ?)", projectID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetProjectMember(projectID, userID)
+}
+
+func (s *Storage) GetProjectMember(projectID, userID int64) (*ProjectMember, error) {
+	var m ProjectMember
+	err := s.db.QueryRow("SELECT projectId, userId, role, createdAt FROM project_members WHERE projectId = ? AND userId = ?", projectID, userID).Scan(&m.ProjectID, &m.UserID, &m.Role, &m.CreatedAt)
+	return &m, err
+}
+
+func (s *Storage) GetProjectMembers(projectID int64) ([]*ProjectMember, error) {
+	rows, err := s.db.Query("SELECT projectId, userId, role, createdAt FROM project_members WHERE projectId = ? ORDER BY createdAt, userId", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*ProjectMember{}
+
+	for rows.Next() {
+		var m ProjectMember
+		err := rows.Scan(&m.ProjectID, &m.UserID, &m.Role, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (s *Storage) UpdateProjectMemberRole(projectID, userID int64, role string) error {
+	_, err := s.db.Exec("UPDATE project_members SET role = ? WHERE projectId = ? AND userId = ?", role, projectID, userID)
+	return err
+}
+
+func (s *Storage) RemoveProjectMember(projectID, userID int64) error {
+	_, err := s.db.Exec("DELETE FROM project_members WHERE projectId = ? AND userId = ?", projectID, userID)
+	return err
+}
+
+func (s *Storage) CreateRefreshToken(t *RefreshToken) error {
+	_, err := s.db.Exec("INSERT INTO refresh_tokens (id, userId, familyId, tokenHash, expiresAt) VALUES (?, ?, ?, ?, ?)", t.ID, t.UserID, t.FamilyID, t.TokenHash, sqlTime(t.ExpiresAt))
+	return err
+}
+
+func (s *Storage) GetRefreshTokenByHash(hash string) (*RefreshToken, error) {
+	var t RefreshToken
+	err := s.db.QueryRow("SELECT id, userId, familyId, tokenHash, expiresAt, usedAt, revokedAt, createdAt FROM refresh_tokens WHERE tokenHash = ?", hash).Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt, &t.CreatedAt)
+	return &t, err
+}
+
+// MarkRefreshTokenUsed flags the token as used and reports whether this call
+// did it, so two concurrent refreshes with the same token cannot both succeed.
+func (s *Storage) MarkRefreshTokenUsed(id string) (bool, error) {
+	res, err := s.db.Exec("UPDATE refresh_tokens SET usedAt = ? WHERE id = ? AND usedAt IS NULL AND revokedAt IS NULL", sqlTime(time.Now()), id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *Storage) RevokeRefreshTokenFamily(familyID string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revokedAt = ? WHERE familyId = ? AND revokedAt IS NULL", sqlTime(time.Now()), familyID)
+	return err
+}
+
+// CreateUserToken stores a new token, making the unused tokens the user had
+// for the same purpose useless so only the latest email works.
+func (s *Storage) CreateUserToken(t *UserToken) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	_, err = tx.Exec("UPDATE user_tokens SET usedAt = ? WHERE userId = ? AND purpose = ? AND usedAt IS NULL", sqlTime(now), t.UserID, t.Purpose)
+	if err != nil {
+		return err
+	}
+
+	// ConsumeUserToken refuses links past their expiry, so issuing a link is
+	// also when the expired ones of every user are cleaned up
+	_, err = tx.Exec("DELETE FROM user_tokens WHERE expiresAt < ?", sqlTime(now))
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("INSERT INTO user_tokens (userId, purpose, tokenHash, expiresAt) VALUES (?, ?, ?, ?)", t.UserID, t.Purpose, t.TokenHash, sqlTime(t.ExpiresAt))
+	if err != nil {
+		return err
+	}
+
+	if t.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUserToken returns the token when it is neither used nor expired,
+// sql.ErrNoRows otherwise.
+func (s *Storage) GetUserToken(hash, purpose string) (*UserToken, error) {
+	var t UserToken
+	err := s.db.QueryRow("SELECT id, userId, purpose, tokenHash, expiresAt, usedAt, createdAt FROM user_tokens WHERE tokenHash = ? AND purpose = ? AND usedAt IS NULL AND expiresAt > ?", hash, purpose, sqlTime(time.Now())).Scan(&t.ID, &t.UserID, &t.Purpose, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// ConsumeUserToken marks the token as used and returns it. sql.ErrNoRows is
+// returned for unknown, expired or already used tokens, and when another
+// request consumed the token first.
+func (s *Storage) ConsumeUserToken(hash, purpose string) (*UserToken, error) {
+	var t UserToken
+	err := s.db.QueryRow("SELECT id, userId, purpose, tokenHash, expiresAt, usedAt, createdAt FROM user_tokens WHERE tokenHash = ? AND purpose = ?", hash, purpose).Scan(&t.ID, &t.UserID, &t.Purpose, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	res, err := s.db.Exec("UPDATE user_tokens SET usedAt = ? WHERE id = ? AND usedAt IS NULL AND expiresAt > ?", sqlTime(now), t.ID, sqlTime(now))
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n != 1 {
+		return nil, sql.ErrNoRows
+	}
+
+	t.UsedAt = &now
+	return &t, nil
+}
+
+// SetTOTPSecret starts an enrollment, or starts it over, with a new secret.
+func (s *Storage) SetTOTPSecret(userID int64, secret string) error {
+	_, err := s.db.Exec("UPDATE users SET totpSecret = ?, totpEnabledAt = NULL, totpLastStep = NULL WHERE id = ?", secret, userID)
+	return err
+}
+
+// EnableTOTP completes the enrollment with the step of the code that
+// confirmed it and the first recovery codes.
+func (s *Storage) EnableTOTP(userID, step int64, codeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totpEnabledAt = ?, totpLastStep = ? WHERE id = ?", sqlTime(time.Now()), step, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) DisableTOTP(userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totpSecret = NULL, totpEnabledAt = NULL, totpLastStep = NULL WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code of step was used and reports whether it
+// was not used before, so a code cannot be replayed within its window.
+func (s *Storage) UseTOTPStep(userID, step int64) (bool, error) {
+	res, err := s.db.Exec("UPDATE users SET totpLastStep = ? WHERE id = ? AND (totpLastStep IS NULL OR totpLastStep < ?)", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *Storage) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int64, codeHashes []string) error {
+	_, err := tx.Exec("DELETE FROM recovery_codes WHERE userId = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (userId, codeHash) VALUES (?, ?)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the user as used and
+// reports whether there was one.
+func (s *Storage) UseRecoveryCode(userID int64, hash string) (bool, error) {
+	res, err := s.db.Exec("UPDATE recovery_codes SET usedAt = ? WHERE userId = ? AND codeHash = ? AND usedAt IS NULL", sqlTime(time.Now()), userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetLoginLock returns until when logins are locked for the subject, the
+// zero time when they are not.
+func (s *Storage) GetLoginLock(kind, subject string) (time.Time, error) {
+	var until *time.Time
+	err := s.db.QueryRow("SELECT lockedUntil FROM login_failures WHERE kind = ? AND subject = ?", kind, subject).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil || until == nil {
+		return time.Time{}, err
+	}
+
+	return *until, nil
+}
+
+// RecordLoginFailure counts a failed login and returns the failures of the
+// subject so far. The count starts over after window without failures.
+func (s *Storage) RecordLoginFailure(kind, subject string, at time.Time, window time.Duration) (int, error) {
+	return s.countInWindow(kind, subject, at, window)
+}
+
+// RecordMailRequest counts a request for an email and returns the requests of
+// the subject so far. The count starts over after window without requests.
+func (s *Storage) RecordMailRequest(kind, subject string, at time.Time, window time.Duration) (int, error) {
+	return s.countInWindow(kind, subject, at, window)
+}
+
+// countInWindow bumps the counter of kind and subject in login_failures, the
+// kinds of login failures and mail requests never overlap.
+func (s *Storage) countInWindow(kind, subject string, at time.Time, window time.Duration) (int, error) {
+	update := func() (int64, error) {
+		// failures comes first to see the old lastFailureAt, see UpdateUserEmail
+		res, err := s.db.Exec("UPDATE login_failures SET failures = CASE WHEN lastFailureAt < ? THEN 1 ELSE failures + 1 END, lastFailureAt = ? WHERE kind = ? AND subject = ?",
+			sqlTime(at.Add(-window)), sqlTime(at), kind, subject)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+
+	n, err := update()
+	if err != nil {
+		return 0, err
+	}
+
+	if n == 0 {
+		_, err = s.db.Exec("INSERT INTO login_failures (kind, subject, failures, lastFailureAt) VALUES (?, ?, 1, ?)", kind, subject, sqlTime(at))
+		// a concurrent failure inserted the row first
+		if isDuplicateKey(err) {
+			_, err = update()
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var failures int
+	err = s.db.QueryRow("SELECT failures FROM login_failures WHERE kind = ? AND subject = ?", kind, subject).Scan(&failures)
+	return failures, err
+}
+
+// LockLogin locks the subject of l until l.LockedUntil and records the
+// lockout.
+func (s *Storage) LockLogin(l *Lockout) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE login_failures SET lockedUntil = ? WHERE kind = ? AND subject = ?", sqlTime(l.LockedUntil), l.Kind, l.Subject)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("INSERT INTO lockouts (kind, subject, userId, ip, failures, lockedUntil) VALUES (?, ?, ?, ?, ?, ?)",
+		l.Kind, l.Subject, nullID(l.UserID), l.IP, l.Failures, sqlTime(l.LockedUntil))
+	if err != nil {
+		return err
+	}
+
+	if l.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) ClearLoginFailures(kind, subject string) error {
+	_, err := s.db.Exec("DELETE FROM login_failures WHERE kind = ? AND subject = ?", kind, subject)
+	return err
+}
+
+const lockoutColumns = "id, kind, subject, COALESCE(userId, 0), ip, failures, lockedUntil, clearedAt, COALESCE(clearedById, 0), createdAt"
+
+func scanLockout(row scanner) (*Lockout, error) {
+	var l Lockout
+	err := row.Scan(&l.ID, &l.Kind, &l.Subject, &l.UserID, &l.IP, &l.Failures, &l.LockedUntil, &l.ClearedAt, &l.ClearedByID, &l.CreatedAt)
+	return &l, err
+}
+
+// ListLockouts returns the lockouts before beforeID, newest first. activeOnly
+// keeps the ones that are neither cleared nor over.
+func (s *Storage) ListLockouts(activeOnly bool, beforeID int64, limit int) ([]*Lockout, error) {
+	where := []string{"1 = 1"}
+	var args []any
+
+	if activeOnly {
+		where = append(where, "clearedAt IS NULL AND lockedUntil > ?")
+		args = append(args, sqlTime(time.Now()))
+	}
+
+	if beforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, beforeID)
+	}
+
+	args = append(args, limit)
+	rows, err := s.db.Query("SELECT "+lockoutColumns+" FROM lockouts WHERE "+strings.Join(where, " AND ")+" ORDER BY id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockouts := []*Lockout{}
+
+	for rows.Next() {
+		l, err := scanLockout(rows)
+		if err != nil {
+			return nil, err
+		}
+		lockouts = append(lockouts, l)
+	}
+
+	return lockouts, rows.Err()
+}
+
+// ClearLockout marks the lockout as cleared by an administrator and forgets
+// the failures of its subject, so logins work again at once.
+func (s *Storage) ClearLockout(id, adminID int64) (*Lockout, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	l, err := scanLockout(tx.QueryRow("SELECT "+lockoutColumns+" FROM lockouts WHERE id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM login_failures WHERE kind = ? AND subject = ?", l.Kind, l.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// every open lockout of the subject is over now
+	now := time.Now()
+	_, err = tx.Exec("UPDATE lockouts SET clearedAt = ?, clearedById = ? WHERE kind = ? AND subject = ? AND clearedAt IS NULL", sqlTime(now), adminID, l.Kind, l.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.ClearedAt == nil {
+		l.ClearedAt, l.ClearedByID = &now, adminID
+	}
+
+	return l, tx.Commit()
+}
+
+func (s *Storage) CreateAccessToken(t *AccessToken) error {
+	res, err := s.db.Exec("INSERT INTO access_tokens (userId, name, prefix, tokenHash, scopes, expiresAt) VALUES (?, ?, ?, ?, ?, ?)",
+		t.UserID, t.Name, t.Prefix, t.TokenHash, strings.Join(t.Scopes, " "), nullTime(t.ExpiresAt))
+	if err != nil {
+		return err
+	}
+
+	t.ID, err = res.LastInsertId()
+	return err
+}
+
+const accessTokenColumns = "id, userId, name, prefix, tokenHash, scopes, expiresAt, lastUsedAt, revokedAt, createdAt"
+
+func scanAccessToken(row scanner) (*AccessToken, error) {
+	var t AccessToken
+	var scopes string
+
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.TokenHash, &scopes, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt)
+	t.Scopes = strings.Fields(scopes)
+
+	return &t, err
+}
+
+func (s *Storage) GetAccessTokenByHash(hash string) (*AccessToken, error) {
+	return scanAccessToken(s.db.QueryRow("SELECT "+accessTokenColumns+" FROM access_tokens WHERE tokenHash = ?", hash))
+}
+
+// ListAccessTokens returns the tokens of the user that are not revoked,
+// expired ones included so they can be told apart from revoked ones.
+func (s *Storage) ListAccessTokens(userID int64) ([]*AccessToken, error) {
+	rows, err := s.db.Query("SELECT "+accessTokenColumns+" FROM access_tokens WHERE userId = ? AND revokedAt IS NULL ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*AccessToken{}
+
+	for rows.Next() {
+		t, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAccessToken revokes a token of the user, sql.ErrNoRows is returned
+// when the user has no such token.
+func (s *Storage) RevokeAccessToken(userID, id int64) error {
+	res, err := s.db.Exec("UPDATE access_tokens SET revokedAt = ? WHERE id = ? AND userId = ? AND revokedAt IS NULL", sqlTime(time.Now()), id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// TouchAccessToken records when the token was last used, at most once a
+// minute so busy scripts do not write on every request.
+func (s *Storage) TouchAccessToken(id int64, at time.Time) error {
+	_, err := s.db.Exec("UPDATE access_tokens SET lastUsedAt = ? WHERE id = ? AND (lastUsedAt IS NULL OR lastUsedAt < ?)", sqlTime(at), id, sqlTime(at.Add(-time.Minute)))
+	return err
+}
+
+func (s *Storage) CreateOIDCLogin(l *OIDCLogin) error {
+	// logins that never came back from the identity provider
+	_, err := s.db.Exec("DELETE FROM oidc_logins WHERE expiresAt < ?", sqlTime(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("INSERT INTO oidc_logins (stateHash, nonce, codeVerifier, expiresAt) VALUES (?, ?, ?, ?)", l.StateHash, l.Nonce, l.CodeVerifier, sqlTime(l.ExpiresAt))
+	return err
+}
+
+// ConsumeOIDCLogin removes the pending login and returns it. sql.ErrNoRows is
+// returned for unknown or expired states, and when another request consumed
+// the state first.
+func (s *Storage) ConsumeOIDCLogin(stateHash string) (*OIDCLogin, error) {
+	var l OIDCLogin
+	err := s.db.QueryRow("SELECT stateHash, nonce, codeVerifier, expiresAt, createdAt FROM oidc_logins WHERE stateHash = ?", stateHash).Scan(&l.StateHash, &l.Nonce, &l.CodeVerifier, &l.ExpiresAt, &l.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.db.Exec("DELETE FROM oidc_logins WHERE stateHash = ?", stateHash)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n != 1 || time.Now().After(l.ExpiresAt) {
+		return nil, sql.ErrNoRows
+	}
+
+	return &l, nil
+}
+
+func (s *Storage) GetUserIdentity(issuer, subject string) (*UserIdentity, error) {
+	var i UserIdentity
+	err := s.db.QueryRow("SELECT id, userId, issuer, subject, email, createdAt FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func (s *Storage) CreateUserIdentity(i *UserIdentity) error {
+	res, err := s.db.Exec("INSERT INTO user_identities (userId, issuer, subject, email) VALUES (?, ?, ?, ?)", i.UserID, i.Issuer, i.Subject, i.Email)
+	if err != nil {
+		return err
+	}
+
+	i.ID, err = res.LastInsertId()
+	return err
+}
+
+// CreateUserWithIdentity creates a user whose email is verified at verifiedAt
+// and links i to them in a single transaction, so a failed link leaves no
+// user behind.
+func (s *Storage) CreateUserWithIdentity(u *CreateUserPayload, verifiedAt time.Time, i *UserIdentity) (*User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO users (email, firstName, lastName, password, emailVerifiedAt) VALUES (?, ?, ?, ?, ?)", u.Email, u.FirstName, u.LastName, u.Password, sqlTime(verifiedAt))
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err = tx.Exec("INSERT INTO user_identities (userId, issuer, subject, email) VALUES (?, ?, ?, ?)", userID, i.Issuer, i.Subject, i.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if i.ID, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+	i.UserID = userID
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &User{
+		ID:              userID,
+		Email:           u.Email,
+		FirstName:       u.FirstName,
+		LastName:        u.LastName,
+		Password:        u.Password,
+		EmailVerifiedAt: &verifiedAt,
+	}, nil
+}
+
+func (s *Storage) RevokeToken(tokenID string, expiresAt time.Time) error {
+	// a token revoked twice, by two logouts racing, stays revoked
+	_, err := s.db.Exec("INSERT INTO revoked_tokens (tokenId, expiresAt) VALUES (?, ?)", tokenID, sqlTime(expiresAt))
+	if err != nil && !isDuplicateKey(err) {
+		return err
+	}
+
+	// expired tokens are rejected anyway, no need to keep them around
+	_, err = s.db.Exec("DELETE FROM revoked_tokens WHERE expiresAt < ?", sqlTime(time.Now()))
+	return err
+}
+
+func (s *Storage) IsTokenRevoked(tokenID string) (bool, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM revoked_tokens WHERE tokenId = ?", tokenID).Scan(&n)
+	return n > 0, err
+}
+
+// RevokeUserTokens invalidates every access token issued to the user before
+// at, and all of the user's refresh tokens.
+func (s *Storage) RevokeUserTokens(userID int64, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET tokensRevokedAt = ? WHERE id = ?", sqlTime(at), userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revokedAt = ? WHERE userId = ? AND revokedAt IS NULL", sqlTime(at), userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const commentColumns = "id, taskId, COALESCE(authorId, 0), body, createdAt, updatedAt"
+
+func scanComment(row scanner) (*Comment, error) {
+	var c Comment
+	err := row.Scan(&c.ID, &c.TaskID, &c.AuthorID, &c.Body, &c.CreatedAt, &c.UpdatedAt)
+	return &c, err
+}
+
+func (s *Storage) CreateComment(taskID, authorID int64, body string) (*Comment, error) {
+	rows, err := s.db.Exec("INSERT INTO comments (taskId, authorId, body) VALUES (?, ?, ?)", taskID, authorID, body)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := rows.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetComment(id)
+}
+
+func (s *Storage) GetComment(id int64) (*Comment, error) {
+	return scanComment(s.db.QueryRow("SELECT "+commentColumns+" FROM comments WHERE id = ?", id))
+}
+
+func (s *Storage) ListComments(taskID int64, afterID int64, limit int) ([]*Comment, error) {
+	rows, err := s.db.Query("SELECT "+commentColumns+" FROM comments WHERE taskId = ? AND id > ? ORDER BY id LIMIT ?", taskID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*Comment{}
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (s *Storage) UpdateComment(id int64, body string) (*Comment, error) {
+	_, err := s.db.Exec("UPDATE comments SET body = ?, updatedAt = ? WHERE id = ?", body, sqlTime(time.Now()), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetComment(id)
+}
+
+func (s *Storage) DeleteComment(id int64) error {
+	_, err := s.db.Exec("DELETE FROM comments WHERE id = ?", id)
+	return err
+}
+
+// SearchDocuments returns the projects, tasks and comments that are not in
+// the trash, of a single project or of all when projectID is zero. It builds
+// the in-process search index.
+func (s *Storage) SearchDocuments(projectID int64) ([]*SearchDocument, error) {
+	rows, err := s.db.Query(
+		"SELECT 'project', id, id, 0, name, COALESCE(description, '') FROM projects WHERE deletedAt IS NULL AND (? = 0 OR id = ?) "+
+			"UNION ALL SELECT 'task', id, projectId, 0, name, COALESCE(description, '') FROM tasks WHERE "+liveTasks+" AND (? = 0 OR projectId = ?) "+
+			"UNION ALL SELECT 'comment', c.id, t.projectId, c.taskId, '', c.body FROM comments c JOIN tasks t ON t.id = c.taskId "+
+			"WHERE "+liveTasks+" AND (? = 0 OR t.projectId = ?)",
+		projectID, projectID, projectID, projectID, projectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []*SearchDocument{}
+
+	for rows.Next() {
+		var d SearchDocument
+		if err := rows.Scan(&d.Kind, &d.ID, &d.ProjectID, &d.TaskID, &d.Title, &d.Body); err != nil {
+			return nil, err
+		}
+		docs = append(docs, &d)
+	}
+
+	return docs, rows.Err()
+}
+
+// GetWorkflow returns the workflow of the project, or the default workflow
+// when the project has none.
+func (s *Storage) GetWorkflow(projectID int64) (*Workflow, error) {
+	rows, err := s.db.Query("SELECT name, isInitial, isTerminal FROM workflow_states WHERE projectId = ? ORDER BY position", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	w := &Workflow{ProjectID: projectID, States: []*WorkflowState{}, Transitions: []*WorkflowTransition{}}
+
+	for rows.Next() {
+		var state WorkflowState
+		if err := rows.Scan(&state.Name, &state.Initial, &state.Terminal); err != nil {
+			return nil, err
+		}
+		w.States = append(w.States, &state)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(w.States) == 0 {
+		return DefaultWorkflow(projectID), nil
+	}
+
+	rows, err = s.db.Query("SELECT fromState, toState FROM workflow_transitions WHERE projectId = ? ORDER BY fromState, toState", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t WorkflowTransition
+		if err := rows.Scan(&t.From, &t.To); err != nil {
+			return nil, err
+		}
+		w.Transitions = append(w.Transitions, &t)
+	}
+
+	return w, rows.Err()
+}
+
+// SaveWorkflow replaces the workflow of the project.
+func (s *Storage) SaveWorkflow(w *Workflow) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteWorkflow(tx, w.ProjectID); err != nil {
+		return err
+	}
+
+	for i, state := range w.States {
+		_, err := tx.Exec("INSERT INTO workflow_states (projectId, name, position, isInitial, isTerminal) VALUES (?, ?, ?, ?, ?)", w.ProjectID, state.Name, i, state.Initial, state.Terminal)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, t := range w.Transitions {
+		_, err := tx.Exec("INSERT INTO workflow_transitions (projectId, fromState, toState) VALUES (?, ?, ?)", w.ProjectID, t.From, t.To)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) DeleteWorkflow(projectID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteWorkflow(tx, projectID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func deleteWorkflow(tx *sql.Tx, projectID int64) error {
+	_, err := tx.Exec("DELETE FROM workflow_transitions WHERE projectId = ?", projectID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM workflow_states WHERE projectId = ?", projectID)
+	return err
+}
+
+func (s *Storage) CountTasksByStatus(projectID int64) (map[string]int, error) {
+	rows, err := s.db.Query("SELECT status, COUNT(*) FROM tasks WHERE projectId = ? AND deletedAt IS NULL GROUP BY status", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// insertTaskEvent appends a task event with the fields that differ between
+// before and after. Updates that change nothing are not recorded.
+func insertTaskEvent(tx *sql.Tx, actorID int64, action string, before, after *Task) error {
+	task := after
+	if task == nil {
+		task = before
+	}
+
+	e := &Event{
+		ProjectID:  task.ProjectID,
+		TaskID:     task.ID,
+		ActorID:    actorID,
+		EntityType: EntityTask,
+		Action:     action,
+		Changes:    diffFields(taskFields(before), taskFields(after)),
+	}
+
+	return insertEvent(tx, e)
+}
+
+func insertProjectEvent(tx *sql.Tx, actorID int64, action string, before, after *Project) error {
+	project := after
+	if project == nil {
+		project = before
+	}
+
+	e := &Event{
+		ProjectID:  project.ID,
+		ActorID:    actorID,
+		EntityType: EntityProject,
+		Action:     action,
+		Changes:    diffFields(projectFields(before), projectFields(after)),
+	}
+
+	return insertEvent(tx, e)
+}
+
+func insertEvent(tx *sql.Tx, e *Event) error {
+	if e.Action == ActionUpdated && len(e.Changes) == 0 {
+		return nil
+	}
+
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO events (projectId, taskId, actorId, entityType, action, changes, createdAt) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		e.ProjectID, nullID(e.TaskID), nullID(e.ActorID), e.EntityType, e.Action, string(changes), sqlTime(time.Now()))
+	return err
+}
+
+// nullID stores a zero id as NULL.
+func nullID(id int64) any {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+// ListEvents returns the events of a task or of a whole project, newest first.
+func (s *Storage) ListEvents(f *EventFilter) ([]*Event, error) {
+	var where []string
+	var args []any
+
+	if f.TaskID != 0 {
+		where = append(where, "taskId = ?")
+		args = append(args, f.TaskID)
+	}
+
+	if f.ProjectID != 0 {
+		where = append(where, "projectId = ?")
+		args = append(args, f.ProjectID)
+	}
+
+	if f.BeforeID != 0 {
+		where = append(where, "id < ?")
+		args = append(args, f.BeforeID)
+	}
+
+	query := "SELECT id, projectId, COALESCE(taskId, 0), COALESCE(actorId, 0), entityType, action, changes, createdAt FROM events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT " + strconv.Itoa(f.Limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+
+	for rows.Next() {
+		var e Event
+		var changes string
+		if err := rows.Scan(&e.ID, &e.ProjectID, &e.TaskID, &e.ActorID, &e.EntityType, &e.Action, &changes, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &e.Changes); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// lockTaskGraph holds the project of the task until tx ends, so cycle checks
+// of its subtasks and dependencies run one at a time and see every edge
+// committed before them. The no-op update takes the row lock in MySQL and
+// makes tx the writer in SQLite, it has to come before any read.
+func lockTaskGraph(tx *sql.Tx, taskID int64) error {
+	_, err := tx.Exec("UPDATE projects SET id = id WHERE id = (SELECT projectId FROM tasks WHERE id = ?)", taskID)
+	return err
+}
+
+// SetTaskParent makes the task a subtask of parentID, or a top level task when
+// parentID is zero. It returns errDependencyCycle if the task is an ancestor
+// of the new parent.
+func (s *Storage) SetTaskParent(taskID, parentID int64, actorID int64) (*Task, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockTaskGraph(tx, taskID); err != nil {
+		return nil, err
+	}
+
+	before, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ?", taskID))
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID != 0 {
+		var cycles int
+		err := tx.QueryRow(`
+			WITH RECURSIVE ancestors(id) AS (
+				SELECT ?
+				UNION
+				SELECT t.parentId FROM tasks t JOIN ancestors a ON t.id = a.id WHERE t.parentId IS NOT NULL
+			)
+			SELECT COUNT(*) FROM ancestors WHERE id = ?`, parentID, taskID).Scan(&cycles)
+		if err != nil {
+			return nil, err
+		}
+		if cycles > 0 {
+			return nil, errDependencyCycle
+		}
+	}
+
+	_, err = tx.Exec("UPDATE tasks SET parentId = ?, version = version + 1 WHERE id = ?", nullID(parentID), taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ?", taskID))
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertTaskEvent(tx, actorID, ActionUpdated, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return after, nil
+}
+
+func (s *Storage) GetSubtasks(taskID int64) ([]*Task, error) {
+	return s.queryTasks("SELECT "+taskColumns+" FROM tasks WHERE parentId = ? AND "+liveTasks+" ORDER BY createdAt, id", taskID)
+}
+
+// AddTaskDependency records that blockerID blocks blockedID. It returns
+// errDependencyCycle if blockedID already blocks blockerID, directly or not.
+func (s *Storage) AddTaskDependency(blockerID, blockedID int64, actorID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockTaskGraph(tx, blockedID); err != nil {
+		return err
+	}
+
+	var exists int
+	err = tx.QueryRow("SELECT COUNT(*) FROM task_dependencies WHERE blockerId = ? AND blockedId = ?", blockerID, blockedID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return errDependencyExists
+	}
+
+	var cycles int
+	err = tx.QueryRow(`
+		WITH RECURSIVE downstream(id) AS (
+			SELECT ?
+			UNION
+			SELECT d.blockedId FROM task_dependencies d JOIN downstream ds ON d.blockerId = ds.id
+		)
+		SELECT COUNT(*) FROM downstream WHERE id = ?`, blockedID, blockerID).Scan(&cycles)
+	if err != nil {
+		return err
+	}
+	if cycles > 0 {
+		return errDependencyCycle
+	}
+
+	_, err = tx.Exec("INSERT INTO task_dependencies (blockerId, blockedId) VALUES (?, ?)", blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	err = insertRelationEvent(tx, actorID, blockedID, "blockedBy", blockerID, true)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) RemoveTaskDependency(blockerID, blockedID int64, actorID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM task_dependencies WHERE blockerId = ? AND blockedId = ?", blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = insertRelationEvent(tx, actorID, blockedID, "blockedBy", blockerID, false)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertRelationEvent records a relation of the task to another row being
+// added or removed, e.g. a blocker or a label, as a change of field.
+func insertRelationEvent(tx *sql.Tx, actorID, taskID int64, field string, relatedID int64, added bool) error {
+	task, err := scanTask(tx.QueryRow("SELECT "+taskColumns+" FROM tasks WHERE id = ?", taskID))
+	if err != nil {
+		return err
+	}
+
+	change := &FieldChange{Field: field, To: relatedID}
+	if !added {
+		change = &FieldChange{Field: field, From: relatedID}
+	}
+
+	e := &Event{
+		ProjectID:  task.ProjectID,
+		TaskID:     task.ID,
+		ActorID:    actorID,
+		EntityType: EntityTask,
+		Action:     ActionUpdated,
+		Changes:    []*FieldChange{change},
+	}
+
+	return insertEvent(tx, e)
+}
+
+// GetTaskBlockers returns the tasks that block taskID.
+func (s *Storage) GetTaskBlockers(taskID int64) ([]*Task, error) {
+	return s.queryTasks("SELECT "+taskColumns+" FROM tasks WHERE id IN (SELECT blockerId FROM task_dependencies WHERE blockedId = ?) AND "+liveTasks+" ORDER BY id", taskID)
+}
+
+// GetBlockedTasks returns the tasks taskID blocks.
+func (s *Storage) GetBlockedTasks(taskID int64) ([]*Task, error) {
+	return s.queryTasks("SELECT "+taskColumns+" FROM tasks WHERE id IN (SELECT blockedId FROM task_dependencies WHERE blockerId = ?) AND "+liveTasks+" ORDER BY id", taskID)
+}
+
+func (s *Storage) queryTasks(query string, args ...any) ([]*Task, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []*Task{}
+
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+const labelColumns = "id, projectId, name, color, createdAt"
+
+func scanLabel(row scanner) (*Label, error) {
+	var l Label
+	err := row.Scan(&l.ID, &l.ProjectID, &l.Name, &l.Color, &l.CreatedAt)
+	return &l, err
+}
+
+// CreateLabel returns errLabelExists if the project already has a label with
+// the same name.
+func (s *Storage) CreateLabel(projectID int64, l *LabelPayload) (*Label, error) {
+	rows, err := s.db.Exec("INSERT INTO labels (projectId, name, color) VALUES (?, ?, ?)", projectID, l.Name, l.Color)
+	if isDuplicateKey(err) {
+		return nil, errLabelExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := rows.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetLabel(id)
+}
+
+func (s *Storage) GetLabel(id int64) (*Label, error) {
+	return scanLabel(s.db.QueryRow("SELECT "+labelColumns+" FROM labels WHERE id = ?", id))
+}
+
+func (s *Storage) GetProjectLabels(projectID int64) ([]*Label, error) {
+	return s.queryLabels("SELECT "+labelColumns+" FROM labels WHERE projectId = ? ORDER BY name", projectID)
+}
+
+func (s *Storage) GetTaskLabels(taskID int64) ([]*Label, error) {
+	return s.queryLabels("SELECT "+labelColumns+" FROM labels WHERE id IN (SELECT labelId FROM task_labels WHERE taskId = ?) ORDER BY name", taskID)
+}
+
+func (s *Storage) queryLabels(query string, args ...any) ([]*Label, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := []*Label{}
+
+	for rows.Next() {
+		l, err := scanLabel(rows)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+func (s *Storage) DeleteLabel(id int64) error {
+	_, err := s.db.Exec("DELETE FROM labels WHERE id = ?", id)
+	return err
+}
+
+// AddTaskLabel attaches the label to the task, attaching it twice is a no-op.
+func (s *Storage) AddTaskLabel(taskID, labelID int64, actorID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO task_labels (taskId, labelId) VALUES (?, ?)", taskID, labelID)
+	// the label is already on the task, there is nothing to record
+	if isDuplicateKey(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = insertRelationEvent(tx, actorID, taskID, "labels", labelID, true)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) RemoveTaskLabel(taskID, labelID int64, actorID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM task_labels WHERE taskId = ? AND labelId = ?", taskID, labelID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return sql.ErrNoRows
+	}
+
+	err = insertRelationEvent(tx, actorID, taskID, "labels", labelID, false)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
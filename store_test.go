@@ -1,5 +1,11 @@
 package main
 
+import (
+	"database/sql"
+	"net/http"
+	"time"
+)
+
 // Mocks
 
 type MockStore struct{}
@@ -8,33 +14,74 @@ func (s *MockStore) CreateUser(u *CreateUserPayload) (*User, error) {
 	return &User{}, nil
 }
 
-func (s *MockStore) CreateProject(p *CreateProjectPayload) (*Project, error) {
+func (s *MockStore) CreateProject(p *CreateProjectPayload, ownerID int64) (*Project, error) {
 	return &Project{}, nil
 }
 
 
 func (s *MockStore) GetProject(id string) (*Project, error) {
-	return &Project{}, nil
+	return &Project{ID: 1, Name: "Engine", OwnerID: 1}, nil
 }
 
-func (s *MockStore)GetProjects() ([]*Project, error){
+func (s *MockStore)GetProjects(userID int64, archived bool) ([]*Project, error){
 	return []*Project{}, nil
 }
 
-func (s *MockStore) CreateTask(t *CreateTaskPayload) (*Task, error) {
-	return &Task{}, nil
+func (s *MockStore) EditProject(id int64, p *EditProjectPayload, actorID int64) (*Project, error) {
+	return &Project{ID: id, Name: p.Name, Description: p.Description, OwnerID: p.OwnerID}, nil
+}
+
+func (s *MockStore) SetProjectArchived(id int64, archived bool, actorID int64) (*Project, error) {
+	project := &Project{ID: id}
+	if archived {
+		now := time.Now()
+		project.ArchivedAt = &now
+	}
+	return project, nil
 }
 
-func (s *MockStore) EditTask(id string, t *EditTaskPayload) (*Task, error) {
-	return &Task{}, nil
+func (s *MockStore) CreateTask(t *CreateTaskPayload, createdByID int64) (*Task, error) {
+	return &Task{Name: t.Name, Status: t.Status, ProjectID: t.ProjectID, AssignedToID: t.AssignedToID, CreatedByID: createdByID}, nil
 }
 
-func (s *MockStore) DeleteProject(id string) error {
+func (s *MockStore) EditTask(id string, t *EditTaskPayload, from string, version int64, actorID int64) (*Task, error) {
+	return &Task{Name: t.Name, Status: t.Status, AssignedToID: t.AssignedToID, Version: version + 1}, nil
+}
+
+func (s *MockStore) DeleteProject(id string, actorID int64) error {
 	return nil
 }
 
+func (s *MockStore) PurgeProject(id int64) error {
+	return nil
+}
+
+func (s *MockStore) ListTrash(userID int64) ([]*TrashItem, error) {
+	return []*TrashItem{}, nil
+}
+
+func (s *MockStore) GetDeletedTask(id int64) (*Task, error) {
+	return &Task{ID: id, Name: "Gears", Status: "BLOCKED", ProjectID: 1, AssignedToID: 1, Version: 3}, nil
+}
+
+func (s *MockStore) GetDeletedProject(id int64) (*Project, error) {
+	return &Project{ID: id, Name: "Engine", OwnerID: 1}, nil
+}
+
+func (s *MockStore) RestoreTask(id int64, status string, actorID int64) (*Task, error) {
+	return &Task{ID: id, Name: "Gears", Status: status, ProjectID: 1, AssignedToID: 1, Version: 4}, nil
+}
+
+func (s *MockStore) RestoreProject(id int64, actorID int64) (*Project, error) {
+	return &Project{ID: id, Name: "Engine", OwnerID: 1}, nil
+}
+
+func (s *MockStore) PurgeTrash(before time.Time) (int64, error) {
+	return 0, nil
+}
+
 func (s *MockStore) GetTask(id string) (*Task, error) {
-	return &Task{}, nil
+	return &Task{ID: 1, Name: "Gears", Status: StatusTODO, ProjectID: 1, AssignedToID: 1, Version: 3}, nil
 }
 
 func (s *MockStore) GetUserByID(id string) (*User, error) {
@@ -45,6 +92,291 @@ func (s *MockStore) GetUserByEmail(email string) (*User, error) {
 	return &User{}, nil
 }
 
-func (s *MockStore) DeleteTask(id string) error {
+func (s *MockStore) ListUsers(query string, afterID int64, limit int) ([]*User, error) {
+	return []*User{}, nil
+}
+
+func (s *MockStore) UpdateUserProfile(id int64, firstName, lastName string) error {
+	return nil
+}
+
+func (s *MockStore) UpdateUserEmail(id int64, email string) error {
+	return nil
+}
+
+func (s *MockStore) UpdateUserPassword(id int64, password string) error {
+	return nil
+}
+
+func (s *MockStore) DeleteUser(id int64) error {
+	return nil
+}
+
+func (s *MockStore) DeleteTask(id string, actorID int64) error {
+	return nil
+}
+func (s *MockStore) ListTasks(f *TaskListFilter) (*TaskPage, error) {
+	return &TaskPage{Tasks: []*Task{}}, nil
+}
+
+func (s *MockStore) GetProjectTasks(projectID int64) ([]*Task, error) {
+	return []*Task{}, nil
+}
+
+func (s *MockStore) AddProjectMember(projectID, userID int64, role string) (*ProjectMember, error) {
+	return &ProjectMember{ProjectID: projectID, UserID: userID, Role: role}, nil
+}
+
+func (s *MockStore) GetProjectMember(projectID, userID int64) (*ProjectMember, error) {
+	return &ProjectMember{ProjectID: projectID, UserID: userID, Role: RoleOwner}, nil
+}
+
+func (s *MockStore) GetProjectMembers(projectID int64) ([]*ProjectMember, error) {
+	return []*ProjectMember{}, nil
+}
+
+func (s *MockStore) UpdateProjectMemberRole(projectID, userID int64, role string) error {
+	return nil
+}
+
+func (s *MockStore) RemoveProjectMember(projectID, userID int64) error {
+	return nil
+}
+
+// withUserID authenticates the request as userID, like WithJWTAuth does.
+func withUserID(r *http.Request, userID int64) *http.Request {
+	return r.WithContext(ContextWithPrincipal(r.Context(), &Principal{UserID: userID, Roles: []string{UserRoleUser}, Session: true}))
+}
+
+func (s *MockStore) MarkEmailVerified(id int64, at time.Time) error {
+	return nil
+}
+
+func (s *MockStore) CreateUserToken(t *UserToken) error {
+	return nil
+}
+
+func (s *MockStore) GetUserToken(hash, purpose string) (*UserToken, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) SetTOTPSecret(userID int64, secret string) error {
+	return nil
+}
+
+func (s *MockStore) EnableTOTP(userID, step int64, codeHashes []string) error {
+	return nil
+}
+
+func (s *MockStore) DisableTOTP(userID int64) error {
+	return nil
+}
+
+func (s *MockStore) UseTOTPStep(userID, step int64) (bool, error) {
+	return true, nil
+}
+
+func (s *MockStore) ReplaceRecoveryCodes(userID int64, codeHashes []string) error {
+	return nil
+}
+
+func (s *MockStore) UseRecoveryCode(userID int64, hash string) (bool, error) {
+	return false, nil
+}
+
+func (s *MockStore) ConsumeUserToken(hash, purpose string) (*UserToken, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) GetLoginLock(kind, subject string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (s *MockStore) RecordLoginFailure(kind, subject string, at time.Time, window time.Duration) (int, error) {
+	return 1, nil
+}
+
+func (s *MockStore) LockLogin(l *Lockout) error {
+	return nil
+}
+
+func (s *MockStore) ClearLoginFailures(kind, subject string) error {
+	return nil
+}
+
+func (s *MockStore) ListLockouts(activeOnly bool, beforeID int64, limit int) ([]*Lockout, error) {
+	return []*Lockout{}, nil
+}
+
+func (s *MockStore) ClearLockout(id, adminID int64) (*Lockout, error) {
+	return &Lockout{ID: id, ClearedByID: adminID}, nil
+}
+
+func (s *MockStore) RecordMailRequest(kind, subject string, at time.Time, window time.Duration) (int, error) {
+	return 1, nil
+}
+
+func (s *MockStore) CreateAccessToken(t *AccessToken) error {
 	return nil
-}
\ No newline at end of file
+}
+
+func (s *MockStore) GetAccessTokenByHash(hash string) (*AccessToken, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) ListAccessTokens(userID int64) ([]*AccessToken, error) {
+	return []*AccessToken{}, nil
+}
+
+func (s *MockStore) RevokeAccessToken(userID, id int64) error {
+	return nil
+}
+
+func (s *MockStore) TouchAccessToken(id int64, at time.Time) error {
+	return nil
+}
+
+func (s *MockStore) CreateOIDCLogin(l *OIDCLogin) error {
+	return nil
+}
+
+func (s *MockStore) ConsumeOIDCLogin(stateHash string) (*OIDCLogin, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) GetUserIdentity(issuer, subject string) (*UserIdentity, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *MockStore) CreateUserIdentity(i *UserIdentity) error {
+	return nil
+}
+
+func (s *MockStore) CreateUserWithIdentity(u *CreateUserPayload, verifiedAt time.Time, i *UserIdentity) (*User, error) {
+	return &User{ID: 1, Email: u.Email, FirstName: u.FirstName, LastName: u.LastName, EmailVerifiedAt: &verifiedAt}, nil
+}
+
+func (s *MockStore) CreateRefreshToken(t *RefreshToken) error {
+	return nil
+}
+
+func (s *MockStore) GetRefreshTokenByHash(hash string) (*RefreshToken, error) {
+	return &RefreshToken{}, nil
+}
+
+func (s *MockStore) MarkRefreshTokenUsed(id string) (bool, error) {
+	return true, nil
+}
+
+func (s *MockStore) RevokeRefreshTokenFamily(familyID string) error {
+	return nil
+}
+
+func (s *MockStore) RevokeToken(tokenID string, expiresAt time.Time) error {
+	return nil
+}
+
+func (s *MockStore) IsTokenRevoked(tokenID string) (bool, error) {
+	return false, nil
+}
+
+func (s *MockStore) RevokeUserTokens(userID int64, at time.Time) error {
+	return nil
+}
+
+func (s *MockStore) CreateComment(taskID, authorID int64, body string) (*Comment, error) {
+	return &Comment{TaskID: taskID, AuthorID: authorID, Body: body}, nil
+}
+
+func (s *MockStore) GetComment(id int64) (*Comment, error) {
+	return &Comment{ID: id, TaskID: 1}, nil
+}
+
+func (s *MockStore) ListComments(taskID int64, afterID int64, limit int) ([]*Comment, error) {
+	return []*Comment{}, nil
+}
+
+func (s *MockStore) UpdateComment(id int64, body string) (*Comment, error) {
+	return &Comment{ID: id, Body: body}, nil
+}
+
+func (s *MockStore) DeleteComment(id int64) error {
+	return nil
+}
+
+func (s *MockStore) GetWorkflow(projectID int64) (*Workflow, error) {
+	return DefaultWorkflow(projectID), nil
+}
+
+func (s *MockStore) SaveWorkflow(w *Workflow) error {
+	return nil
+}
+
+func (s *MockStore) DeleteWorkflow(projectID int64) error {
+	return nil
+}
+
+func (s *MockStore) CountTasksByStatus(projectID int64) (map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+func (s *MockStore) ListEvents(f *EventFilter) ([]*Event, error) {
+	return []*Event{}, nil
+}
+
+func (s *MockStore) SearchDocuments(projectID int64) ([]*SearchDocument, error) {
+	return []*SearchDocument{}, nil
+}
+
+func (s *MockStore) SetTaskParent(taskID, parentID int64, actorID int64) (*Task, error) {
+	return &Task{ID: taskID, ParentID: parentID}, nil
+}
+
+func (s *MockStore) GetSubtasks(taskID int64) ([]*Task, error) {
+	return []*Task{}, nil
+}
+
+func (s *MockStore) AddTaskDependency(blockerID, blockedID int64, actorID int64) error {
+	return nil
+}
+
+func (s *MockStore) RemoveTaskDependency(blockerID, blockedID int64, actorID int64) error {
+	return nil
+}
+
+// GetTaskBlockers reports one open blocker so closing tasks needs force.
+func (s *MockStore) GetTaskBlockers(taskID int64) ([]*Task, error) {
+	return []*Task{{ID: 2, Status: StatusInProgress, ProjectID: 1}}, nil
+}
+
+func (s *MockStore) GetBlockedTasks(taskID int64) ([]*Task, error) {
+	return []*Task{}, nil
+}
+
+func (s *MockStore) CreateLabel(projectID int64, l *LabelPayload) (*Label, error) {
+	return &Label{ID: 1, ProjectID: projectID, Name: l.Name, Color: l.Color}, nil
+}
+
+func (s *MockStore) GetLabel(id int64) (*Label, error) {
+	return &Label{ID: id, ProjectID: 1, Name: "bug", Color: "#ff0000"}, nil
+}
+
+func (s *MockStore) GetProjectLabels(projectID int64) ([]*Label, error) {
+	return []*Label{}, nil
+}
+
+func (s *MockStore) DeleteLabel(id int64) error {
+	return nil
+}
+
+func (s *MockStore) AddTaskLabel(taskID, labelID int64, actorID int64) error {
+	return nil
+}
+
+func (s *MockStore) RemoveTaskLabel(taskID, labelID int64, actorID int64) error {
+	return nil
+}
+
+func (s *MockStore) GetTaskLabels(taskID int64) ([]*Label, error) {
+	return []*Label{}, nil
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 )
@@ -16,12 +23,28 @@ const (
 	StatusDone       = "DONE"
 )
 
-var validStatuses = map[string]bool{
-	StatusTODO:      true,
-	StatusInProgress: true,
-	StatusInTesting:  true,
-	StatusDone:       true,
-}
+// defaultStatuses are the states of the default workflow, in board order.
+var defaultStatuses = []string{StatusTODO, StatusInProgress, StatusInTesting, StatusDone}
+
+// statusPattern is the format of workflow state names. Whether a status is
+// valid for a task depends on the workflow of its project.
+var statusPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
+
+const (
+	PriorityLow    = "LOW"
+	PriorityMedium = "MEDIUM"
+	PriorityHigh   = "HIGH"
+	PriorityUrgent = "URGENT"
+)
+
+// priorities are ordered by urgency, tasks store the index plus one so they
+// sort the same way.
+var priorities = []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+const (
+	maxDescriptionLength = 20000
+	maxEstimate          = 1000
+)
 
 type TasksService struct {
 	store Store
@@ -32,10 +55,24 @@ func NewTasksService(s Store) *TasksService {
 }
 
 func (s *TasksService) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/tasks", WithJWTAuth(s.handleCreateTask, s.store)).Methods("POST")
-	r.HandleFunc("/tasks/{id}", WithJWTAuth(s.handleGetTask, s.store)).Methods("GET")
-	r.HandleFunc("/tasks/{id}", WithJWTAuth(s.handleDeleteTask, s.store)).Methods("DELETE")
-	r.HandleFunc("/tasks/{id}", WithJWTAuth(s.handleEditTask, s.store)).Methods("PUT")
+	r.HandleFunc("/tasks", WithJWTAuth(s.handleCreateTask, s.store, ScopeTasksWrite)).Methods("POST")
+	r.HandleFunc("/tasks", WithJWTAuth(s.handleListTasks, s.store, ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/tasks/{id}", WithJWTAuth(s.handleGetTask, s.store, ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/tasks/{id}", WithJWTAuth(s.handleDeleteTask, s.store, ScopeTasksWrite)).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}", WithJWTAuth(s.handleEditTask, s.store, ScopeTasksWrite)).Methods("PUT")
+	r.HandleFunc("/tasks/{id}", WithJWTAuth(s.handlePatchTask, s.store, ScopeTasksWrite)).Methods("PATCH")
+	r.HandleFunc("/tasks/{id}/subtasks", WithJWTAuth(s.handleGetSubtasks, s.store, ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/tasks/{id}/parent", WithJWTAuth(s.handleSetParent, s.store, ScopeTasksWrite)).Methods("PUT")
+	r.HandleFunc("/tasks/{id}/dependencies", WithJWTAuth(s.handleGetDependencies, s.store, ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/tasks/{id}/dependencies", WithJWTAuth(s.handleAddDependency, s.store, ScopeTasksWrite)).Methods("POST")
+	r.HandleFunc("/tasks/{id}/dependencies/{blockerId}", WithJWTAuth(s.handleRemoveDependency, s.store, ScopeTasksWrite)).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}/labels", WithJWTAuth(s.handleAddTaskLabel, s.store, ScopeTasksWrite)).Methods("POST")
+	r.HandleFunc("/tasks/{id}/labels/{labelId}", WithJWTAuth(s.handleRemoveTaskLabel, s.store, ScopeTasksWrite)).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}/history", WithJWTAuth(s.handleGetTaskHistory, s.store, ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/tasks/{id}/comments", WithJWTAuth(s.handleGetComments, s.store, ScopeTasksRead)).Methods("GET")
+	r.HandleFunc("/tasks/{id}/comments", WithJWTAuth(s.handleCreateComment, s.store, ScopeTasksWrite)).Methods("POST")
+	r.HandleFunc("/tasks/{id}/comments/{commentId}", WithJWTAuth(s.handleEditComment, s.store, ScopeTasksWrite)).Methods("PUT")
+	r.HandleFunc("/tasks/{id}/comments/{commentId}", WithJWTAuth(s.handleDeleteComment, s.store, ScopeTasksWrite)).Methods("DELETE")
 }
 
 func (s *TasksService) handleCreateTask(w http.ResponseWriter, r *http.Request) {
@@ -53,43 +90,124 @@ func (s *TasksService) handleCreateTask(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		permissionDenied(w)
+		return
+	}
+
+	// tasks are assigned to whoever creates them unless told otherwise
+	if taskPayload.AssignedToID == 0 {
+		taskPayload.AssignedToID = principal.UserID
+	}
+
 	if err := validateTaskPayload(taskPayload); err != nil {
 		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	t, err := s.store.CreateTask(taskPayload)
+	if _, ok := authorizeProject(s.store, w, r, taskPayload.ProjectID, RoleMember); !ok {
+		return
+	}
+
+	if !checkProjectWritable(s.store, w, taskPayload.ProjectID) {
+		return
+	}
+
+	if !s.checkAssignee(w, taskPayload.ProjectID, taskPayload.AssignedToID) {
+		return
+	}
+
+	if taskPayload.ParentID != 0 && !s.checkRelatedTask(w, &Task{ProjectID: taskPayload.ProjectID}, taskPayload.ParentID) {
+		return
+	}
+
+	workflow, err := s.store.GetWorkflow(taskPayload.ProjectID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the workflow"})
+		return
+	}
+
+	// new tasks start in the initial state of the project workflow
+	if taskPayload.Status == "" {
+		taskPayload.Status = workflow.InitialState()
+	}
+	if workflow.State(taskPayload.Status) == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("%s: %q is not a state of the project workflow", invalidStatus, taskPayload.Status)})
+		return
+	}
+
+	t, err := s.store.CreateTask(taskPayload, principal.UserID)
 	if err != nil {
 		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while creating the task"})
 		return
 	}
 
+	w.Header().Set("ETag", taskETag(t))
 	WriteJSON(w, http.StatusCreated, t)
 }
 
 func (s *TasksService) handleGetTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	task, _, ok := s.loadTask(w, r, RoleViewer)
+	if !ok {
+		return
+	}
 
-	if id == "" {
-		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "id is required"})
+	var err error
+	if task.Labels, err = s.store.GetTaskLabels(task.ID); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing labels"})
 		return
 	}
 
-	task, err := s.store.GetTask(id)
+	subtasks, err := s.store.GetSubtasks(task.ID)
 	if err != nil {
-		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "task not found"})
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing subtasks"})
 		return
 	}
 
+	if len(subtasks) > 0 {
+		workflow, err := s.store.GetWorkflow(task.ProjectID)
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the workflow"})
+			return
+		}
+		task.Progress = rollUp(workflow, subtasks)
+	}
+
+	w.Header().Set("ETag", taskETag(task))
 	WriteJSON(w, http.StatusOK, task)
 }
 
+func (s *TasksService) handleListTasks(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskListFilter(r)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// only list tasks of projects the caller belongs to
+	filter.MemberID = GetUserIDFromContext(r.Context())
+	if filter.MemberID == 0 {
+		permissionDenied(w)
+		return
+	}
+
+	page, err := s.store.ListTasks(filter)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing tasks"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, page)
+}
+
 func (s *TasksService) handleDeleteTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	task, _, ok := s.loadTask(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
 
-	err := s.store.DeleteTask(id)
+	err := s.store.DeleteTask(strconv.FormatInt(task.ID, 10), GetUserIDFromContext(r.Context()))
 	if err != nil {
 		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error deleting task"})
 		return
@@ -100,17 +218,13 @@ func (s *TasksService) handleDeleteTask(w http.ResponseWriter, r *http.Request)
 
 
 func (s *TasksService) handleEditTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	if id == "" {
-		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "id is required"})
+	task, _, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
 		return
 	}
 
-	_, err := s.store.GetTask(id)
-	if err != nil {
-		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("task with ID %s not found", id)})
+	version, ok := checkIfMatch(w, r, task)
+	if !ok {
 		return
 	}
 
@@ -128,24 +242,280 @@ func (s *TasksService) handleEditTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	t, ok := s.updateTask(w, r, task, taskPayload, version)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(t))
+	WriteJSON(w, http.StatusCreated, t)
+}
+
+// handlePatchTask applies a JSON Merge Patch to the task. Without If-Match the
+// patch still only applies to the version it was merged with.
+func (s *TasksService) handlePatchTask(w http.ResponseWriter, r *http.Request) {
+	task, _, ok := s.loadTask(w, r, RoleMember)
+	if !ok {
+		return
+	}
+
+	if _, ok := checkIfMatch(w, r, task); !ok {
+		return
+	}
+
+	if !isMergePatch(r) {
+		WriteJSON(w, http.StatusUnsupportedMediaType, ErrorResponse{Error: errUnsupportedPatch.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	current := &EditTaskPayload{Name: task.Name, Status: task.Status, AssignedToID: task.AssignedToID, TaskDetails: task.TaskDetails}
+
+	var taskPayload EditTaskPayload
+	if err := applyMergePatch(current, body, &taskPayload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid merge patch: " + err.Error()})
+		return
+	}
+
+	t, ok := s.updateTask(w, r, task, &taskPayload, task.Version)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(t))
+	WriteJSON(w, http.StatusOK, t)
+}
+
+// updateTask validates the new values of the task and saves them if the task
+// is still at version, or unconditionally when version is zero. Moving a task
+// to a terminal state requires its blockers to be done, or ?force=true.
+func (s *TasksService) updateTask(w http.ResponseWriter, r *http.Request, task *Task, taskPayload *EditTaskPayload, version int64) (*Task, bool) {
 	if err := validateEditTaskPayload(taskPayload); err != nil {
 		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
+		return nil, false
+	}
+
+	if !s.checkAssignee(w, task.ProjectID, taskPayload.AssignedToID) {
+		return nil, false
+	}
+
+	workflow, err := s.store.GetWorkflow(task.ProjectID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the workflow"})
+		return nil, false
+	}
+
+	if err := workflow.checkTransition(task.Status, taskPayload.Status); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return nil, false
+	}
+
+	// open blockers keep a task from being finished unless ?force=true
+	closing := task.Status != taskPayload.Status && workflow.State(taskPayload.Status).Terminal
+	if closing && r.URL.Query().Get("force") != "true" && !s.checkBlockers(w, workflow, task) {
+		return nil, false
 	}
 
-	t, err := s.store.EditTask(id, taskPayload)
+	t, err := s.store.EditTask(strconv.FormatInt(task.ID, 10), taskPayload, task.Status, version, GetUserIDFromContext(r.Context()))
+	if errors.Is(err, errVersionConflict) {
+		WriteJSON(w, http.StatusPreconditionFailed, ErrorResponse{Error: err.Error()})
+		return nil, false
+	}
+	if errors.Is(err, errStatusChanged) {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return nil, false
+	}
 	if err != nil {
 		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while updating the task"})
-		return
+		return nil, false
 	}
 
-	WriteJSON(w, http.StatusCreated, t)
+	return t, true
+}
 
+// loadTask loads the task named by the {id} route variable once the caller is
+// authorized for its project with at least minRole, and writes the error
+// response otherwise. Tasks of archived projects can be read by anyone allowed
+// to, only loading them for a change is refused. The returned bool reports
+// whether the handler may continue.
+func (s *TasksService) loadTask(w http.ResponseWriter, r *http.Request, minRole string) (*Task, *ProjectMember, bool) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "id is required"})
+		return nil, nil, false
+	}
+
+	task, err := s.store.GetTask(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "task not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the task"})
+		return nil, nil, false
+	}
+
+	member, ok := authorizeProject(s.store, w, r, task.ProjectID, minRole)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// anything above reading changes the task, which archiving forbids
+	if minRole != RoleViewer && !checkProjectWritable(s.store, w, task.ProjectID) {
+		return nil, nil, false
+	}
+
+	return task, member, true
+}
+
+// checkAssignee makes sure tasks are only assigned to members of their project.
+func (s *TasksService) checkAssignee(w http.ResponseWriter, projectID, userID int64) bool {
+	_, err := s.store.GetProjectMember(projectID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errAssigneeNotMember.Error()})
+		return false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while checking project membership"})
+		return false
+	}
+
+	return true
+}
+
+// parseTaskListFilter reads the task listing filters from the query string.
+// Statuses may be repeated or comma separated, e.g. ?status=TODO,DONE.
+func parseTaskListFilter(r *http.Request) (*TaskListFilter, error) {
+	q := r.URL.Query()
+
+	filter := &TaskListFilter{
+		Sort: "createdAt",
+	}
+
+	for _, value := range q["status"] {
+		for _, status := range strings.Split(value, ",") {
+			if err := validateStatus(status); err != nil {
+				return nil, err
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	var err error
+	if filter.ProjectID, err = parseIDParam(q.Get("projectId")); err != nil {
+		return nil, err
+	}
+
+	if filter.AssignedToID, err = parseIDParam(q.Get("assignedToId")); err != nil {
+		return nil, err
+	}
+
+	if filter.CreatedAfter, err = parseTimeParam(q.Get("createdAfter")); err != nil {
+		return nil, err
+	}
+
+	if filter.CreatedBefore, err = parseTimeParam(q.Get("createdBefore")); err != nil {
+		return nil, err
+	}
+
+	for _, value := range q["priority"] {
+		for _, priority := range strings.Split(value, ",") {
+			if priorityRank(priority) == 0 {
+				return nil, errInvalidPriority
+			}
+			filter.Priorities = append(filter.Priorities, priority)
+		}
+	}
+
+	if filter.LabelsAny, err = parseIDList(q["labelAny"]); err != nil {
+		return nil, err
+	}
+
+	if filter.LabelsAll, err = parseIDList(q["labelAll"]); err != nil {
+		return nil, err
+	}
+
+	if filter.LabelsNone, err = parseIDList(q["labelNone"]); err != nil {
+		return nil, err
+	}
+
+	if filter.DueAfter, err = parseTimeParam(q.Get("dueAfter")); err != nil {
+		return nil, err
+	}
+
+	if filter.DueBefore, err = parseTimeParam(q.Get("dueBefore")); err != nil {
+		return nil, err
+	}
+
+	if sort := q.Get("sort"); sort != "" {
+		if _, ok := taskSortColumns[sort]; !ok {
+			return nil, errInvalidSort
+		}
+		filter.Sort = sort
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return nil, errInvalidOrder
+	}
+
+	if filter.Limit, err = parseLimit(r); err != nil {
+		return nil, err
+	}
+
+	if filter.Cursor, err = decodeCursor(q.Get("cursor")); err != nil {
+		return nil, err
+	}
+
+	if filter.Cursor != nil && (filter.Cursor.Sort != filter.Sort || filter.Cursor.Desc != filter.Desc) {
+		return nil, errCursorMismatch
+	}
+
+	return filter, nil
+}
+
+func parseIDParam(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		return 0, errInvalidID
+	}
+
+	return id, nil
+}
+
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errInvalidDate
+	}
+
+	return &t, nil
 }
 
 func validateTaskPayload(task *CreateTaskPayload) error {
-	if task.Status == "" {
-		task.Status = "TODO"
+	if task.Status != "" {
+		if err := validateStatus(task.Status); err != nil {
+			return err
+		}
 	}
 
 	if task.Name == "" {
@@ -160,7 +530,7 @@ func validateTaskPayload(task *CreateTaskPayload) error {
 		return errUserIDRequired
 	}
 
-	return nil
+	return validateTaskDetails(&task.TaskDetails)
 }
 
 func validateEditTaskPayload(task *EditTaskPayload) error {
@@ -180,11 +550,60 @@ func validateEditTaskPayload(task *EditTaskPayload) error {
 		return errUserIDRequired
 	}
 
+	return validateTaskDetails(&task.TaskDetails)
+}
+
+// validateTaskDetails checks the planning fields and defaults the priority to
+// MEDIUM.
+func validateTaskDetails(d *TaskDetails) error {
+	if d.Priority == "" {
+		d.Priority = PriorityMedium
+	}
+
+	if priorityRank(d.Priority) == 0 {
+		return errInvalidPriority
+	}
+
+	if utf8.RuneCountInString(d.Description) > maxDescriptionLength {
+		return errDescriptionTooLong
+	}
+
+	if d.StartDate != nil && d.DueDate != nil && d.StartDate.After(*d.DueDate) {
+		return errInvalidDateRange
+	}
+
+	if d.Estimate != nil && (*d.Estimate < 0 || *d.Estimate > maxEstimate) {
+		return errInvalidEstimate
+	}
+
+	if d.TimeSpentMinutes < 0 {
+		return errInvalidTimeSpent
+	}
+
 	return nil
 }
 
+// priorityRank returns the stored rank of a priority, or 0 if it is unknown.
+func priorityRank(priority string) int {
+	for i, p := range priorities {
+		if p == priority {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func priorityName(rank int) string {
+	if rank < 1 || rank > len(priorities) {
+		return ""
+	}
+
+	return priorities[rank-1]
+}
+
 func validateStatus(status string) error {
-	if !validStatuses[status] {
+	if !statusPattern.MatchString(status) {
 		return invalidStatus
 	}
 	return nil
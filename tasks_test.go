@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"time"
 
 	"testing"
 
@@ -34,7 +36,7 @@ func TestCreateTask(t *testing.T) {
 		router := mux.NewRouter()
 
 		router.HandleFunc("/tasks", service.handleCreateTask)
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withUserID(req, 1))
 
 		if rr.Code != http.StatusBadRequest {
 			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
@@ -74,7 +76,7 @@ func TestCreateTask(t *testing.T) {
 
 		router.HandleFunc("/tasks", service.handleCreateTask)
 
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withUserID(req, 1))
 
 		if rr.Code != http.StatusCreated {
 			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
@@ -82,6 +84,47 @@ func TestCreateTask(t *testing.T) {
 	})
 }
 
+func TestCreateTaskDefaults(t *testing.T) {
+	ms := &MockStore{}
+	service := NewTasksService(ms)
+
+	t.Run("should assign the task to the caller by default", func(t *testing.T) {
+		payload := &CreateTaskPayload{
+			Name:      "Write the changelog",
+			ProjectID: 1,
+		}
+
+		b, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "/tasks", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks", service.handleCreateTask)
+		router.ServeHTTP(rr, withUserID(req, 7))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var task Task
+		if err := json.NewDecoder(rr.Body).Decode(&task); err != nil {
+			t.Fatal(err)
+		}
+
+		if task.AssignedToID != 7 || task.CreatedByID != 7 {
+			t.Errorf("expected task assigned to and created by 7, got %d and %d", task.AssignedToID, task.CreatedByID)
+		}
+	})
+}
+
 func TestGetTask(t *testing.T){
 	ms := &MockStore{}
 	service := NewTasksService(ms)
@@ -97,7 +140,7 @@ func TestGetTask(t *testing.T){
 
 		router.HandleFunc("/tasks/{id}", service.handleGetTask)
 		
-		router.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, withUserID(req, 1))
 
 		if rr.Code != http.StatusOK {
 			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
@@ -105,3 +148,112 @@ func TestGetTask(t *testing.T){
 
 	})
 }
+
+func TestListTasks(t *testing.T) {
+	ms := &MockStore{}
+	service := NewTasksService(ms)
+
+	t.Run("should return error if status is invalid", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/tasks?status=TODO,in-progress", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks", service.handleListTasks)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return error if cursor is malformed", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/tasks?cursor=not-a-cursor", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks", service.handleListTasks)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return error if cursor is for another order", func(t *testing.T) {
+		c := encodeCursor(cursor{Value: "b", ID: 2, Sort: "name"})
+
+		req, err := http.NewRequest(http.MethodGet, "/tasks?sort=name&order=desc&cursor="+c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks", service.handleListTasks)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should list tasks", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/tasks?status=TODO&projectId=1&sort=name&order=desc&limit=10", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/tasks", service.handleListTasks)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+func TestValidateTaskDetails(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	before := day.AddDate(0, 0, -1)
+	negative := -1
+
+	tests := []struct {
+		name    string
+		details TaskDetails
+		err     error
+	}{
+		{"defaults", TaskDetails{}, nil},
+		{"unknown priority", TaskDetails{Priority: "CRITICAL"}, errInvalidPriority},
+		{"long description", TaskDetails{Description: strings.Repeat("a", maxDescriptionLength+1)}, errDescriptionTooLong},
+		{"start after due", TaskDetails{StartDate: &day, DueDate: &before}, errInvalidDateRange},
+		{"negative estimate", TaskDetails{Estimate: &negative}, errInvalidEstimate},
+		{"negative time spent", TaskDetails{TimeSpentMinutes: -5}, errInvalidTimeSpent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.details
+			if err := validateTaskDetails(&d); err != tt.err {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	d := TaskDetails{}
+	validateTaskDetails(&d)
+	if d.Priority != PriorityMedium {
+		t.Errorf("expected priority %s, got %s", PriorityMedium, d.Priority)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// issueTokens creates an access token and a refresh token for the user. An
+// empty familyID starts a new token family, as on login.
+func issueTokens(store Store, userID int64, familyID string) (*TokenResponse, error) {
+	accessToken, err := CreateJWT(signingKeys, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		familyID = newTokenID()
+	}
+
+	err = store.CreateRefreshToken(&RefreshToken{
+		ID:        newTokenID(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(Envs.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(Envs.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// handleRefreshToken exchanges a refresh token for a new token pair. Every
+// refresh token can be used once, presenting it again revokes its family.
+func (s *UserService) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *RefreshTokenPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if payload.RefreshToken == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errRefreshTokenRequired.Error()})
+		return
+	}
+
+	token, err := s.store.GetRefreshTokenByHash(hashToken(payload.RefreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Error: errInvalidRefreshToken.Error()})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error refreshing token"})
+		return
+	}
+
+	if token.UsedAt != nil || token.RevokedAt != nil {
+		s.revokeReusedFamily(w, token)
+		return
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Error: errInvalidRefreshToken.Error()})
+		return
+	}
+
+	used, err := s.store.MarkRefreshTokenUsed(token.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error refreshing token"})
+		return
+	}
+
+	// someone else used the token between our read and our update
+	if !used {
+		s.revokeReusedFamily(w, token)
+		return
+	}
+
+	tokens, err := createAndSetAuthCookie(s.store, token.UserID, token.FamilyID, w)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error refreshing token"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, tokens)
+}
+
+func (s *UserService) revokeReusedFamily(w http.ResponseWriter, token *RefreshToken) {
+	log.Printf("refresh token reuse for user %d, revoking family %s", token.UserID, token.FamilyID)
+
+	if err := s.store.RevokeRefreshTokenFamily(token.FamilyID); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error refreshing token"})
+		return
+	}
+
+	WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Error: errRefreshTokenReused.Error()})
+}
+
+// newOpaqueToken returns a random, URL safe token for clients to hold on to.
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how opaque tokens are stored, they are random enough not to
+// need a salt.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// handleLogout revokes the access token of the request and, when given, the
+// refresh token family it was issued with.
+func (s *UserService) handleLogout(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		permissionDenied(w)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload LogoutPayload
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+			return
+		}
+	}
+
+	if err := tokenRevocations.Revoke(s.store, principal.TokenID, principal.ExpiresAt); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error logging out"})
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		token, err := s.store.GetRefreshTokenByHash(hashToken(payload.RefreshToken))
+		if err == nil && token.UserID == principal.UserID {
+			err = s.store.RevokeRefreshTokenFamily(token.FamilyID)
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error logging out"})
+			return
+		}
+	}
+
+	clearAuthCookie(w)
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handleLogoutAll revokes every access and refresh token of the caller,
+// personal access tokens included.
+func (s *UserService) handleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		permissionDenied(w)
+		return
+	}
+
+	if err := s.store.RevokeUserTokens(principal.UserID, time.Now()); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error logging out"})
+		return
+	}
+
+	// the current token may have been issued in the same second
+	if err := tokenRevocations.Revoke(s.store, principal.TokenID, principal.ExpiresAt); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error logging out"})
+		return
+	}
+
+	clearAuthCookie(w)
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func clearAuthCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "Authorization",
+		Value:    "",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
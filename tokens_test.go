@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+)
+
+func TestValidateJWT(t *testing.T) {
+	sign := func(claims jwt.StandardClaims) string {
+		token, err := signingKeys.Sign(&TokenClaims{StandardClaims: claims})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	valid := func() jwt.StandardClaims {
+		return jwt.StandardClaims{
+			Subject:   "1",
+			Id:        newTokenID(),
+			Issuer:    Envs.JWTIssuer,
+			Audience:  Envs.JWTAudience,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	t.Run("should accept tokens from CreateJWT", func(t *testing.T) {
+		token, err := CreateJWT(signingKeys, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := validateJWT(token); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("should reject expired tokens", func(t *testing.T) {
+		claims := valid()
+		claims.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+
+		if _, err := validateJWT(sign(claims)); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should reject tokens without expiry", func(t *testing.T) {
+		claims := valid()
+		claims.ExpiresAt = 0
+
+		if _, err := validateJWT(sign(claims)); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should reject tokens for another audience", func(t *testing.T) {
+		claims := valid()
+		claims.Audience = "someone-else"
+
+		if _, err := validateJWT(sign(claims)); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestRefreshToken(t *testing.T) {
+	store := newTestStore(t)
+	service := NewUserService(store, NewLogMailer("", io.Discard))
+
+	u, err := store.CreateUser(&CreateUserPayload{Email: "grace@example.com", FirstName: "Grace", LastName: "Hopper", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		b, err := json.Marshal(&RefreshTokenPayload{RefreshToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "/users/refresh", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/users/refresh", service.handleRefreshToken)
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	first, err := issueTokens(store, u.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var second TokenResponse
+
+	t.Run("should rotate the refresh token", func(t *testing.T) {
+		rr := refresh(first.RefreshToken)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		if err := json.NewDecoder(rr.Body).Decode(&second); err != nil {
+			t.Fatal(err)
+		}
+
+		if second.RefreshToken == first.RefreshToken {
+			t.Error("expected a new refresh token")
+		}
+
+		token, err := validateJWT(second.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sub := token.Claims.(*TokenClaims).Subject; sub != strconv.FormatInt(u.ID, 10) {
+			t.Errorf("expected subject %d, got %s", u.ID, sub)
+		}
+	})
+
+	t.Run("should revoke the family when a token is replayed", func(t *testing.T) {
+		if rr := refresh(first.RefreshToken); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		if rr := refresh(second.RefreshToken); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected the rotated token to be revoked, got status code %d", rr.Code)
+		}
+	})
+}
+
+func TestLogout(t *testing.T) {
+	store := newTestStore(t)
+	service := NewUserService(store, NewLogMailer("", io.Discard))
+
+	u, err := store.CreateUser(&CreateUserPayload{Email: "alan@example.com", FirstName: "Alan", LastName: "Turing", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, nil)
+	}
+
+	call := func(path string, handler http.HandlerFunc, token string) int {
+		req, err := http.NewRequest(http.MethodPost, path, http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc(path, WithJWTAuth(handler, store))
+		router.ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	t.Run("should revoke the current token", func(t *testing.T) {
+		token, err := CreateJWT(signingKeys, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code := call("/ping", ok, token); code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+		}
+
+		if code := call("/users/logout", service.handleLogout, token); code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, code)
+		}
+
+		if code := call("/ping", ok, token); code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+
+	t.Run("should accept a token revoked twice", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Minute)
+
+		for i := 0; i < 2; i++ {
+			if err := store.RevokeToken("twice", expiresAt); err != nil {
+				t.Fatalf("revocation %d: %v", i+1, err)
+			}
+		}
+	})
+
+	t.Run("should revoke every token of the user", func(t *testing.T) {
+		other, err := CreateJWT(signingKeys, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tokens issued before logout-all, in an earlier second
+		if err := store.RevokeUserTokens(u.ID, time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		if code := call("/ping", ok, other); code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, code)
+		}
+	})
+}
+
+func TestRevocationCache(t *testing.T) {
+	cache := newRevocationCache(0)
+	cache.SetBackend(NewMemoryRevocationStore())
+
+	if err := cache.Revoke(nil, "revoked", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// with no ttl every lookup of a valid token is stale at once
+	for i := 0; i < revocationSweepMin; i++ {
+		if _, err := cache.IsRevoked(nil, strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(cache.entries) != 2 {
+		t.Errorf("expected the revoked token and the last lookup after a sweep, got %d entries", len(cache.entries))
+	}
+	if revoked, _ := cache.IsRevoked(nil, "revoked"); !revoked {
+		t.Error("expected the revoked token to be remembered")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// the SHA1 test vectors of RFC 6238, appendix B
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := totpCode(secret, totpStep(time.Unix(tt.unix, 0)), 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.expected {
+			t.Errorf("expected %s at %d, got %s", tt.expected, tt.unix, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code := func(offset int64) string {
+		c, err := totpCode(secret, totpStep(now)+offset, totpDigits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if step, ok := validateTOTP(secret, code(-1), now); !ok || step != totpStep(now)-1 {
+		t.Error("expected the previous code to be accepted")
+	}
+
+	if _, ok := validateTOTP(secret, code(2), now); ok {
+		t.Error("expected codes outside the skew to be refused")
+	}
+
+	if _, ok := validateTOTP(secret, "12345", now); ok {
+		t.Error("expected short codes to be refused")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("JBSWY3DPEHPK3PXP", "ada@example.com")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "ada@example.com") {
+		t.Errorf("unexpected uri %s", uri)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	TrashTypeTask    = "task"
+	TrashTypeProject = "project"
+)
+
+type TrashService struct {
+	store Store
+}
+
+func NewTrashService(s Store) *TrashService {
+	return &TrashService{store: s}
+}
+
+func (s *TrashService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/trash", WithJWTAuth(s.handleGetTrash, s.store)).Methods("GET")
+	r.HandleFunc("/trash/{type}/{id}/restore", WithJWTAuth(s.handleRestore, s.store)).Methods("POST")
+}
+
+// handleGetTrash lists what was deleted from the projects of the caller, with
+// the time each item is purged.
+func (s *TrashService) handleGetTrash(w http.ResponseWriter, r *http.Request) {
+	userID := GetUserIDFromContext(r.Context())
+	if userID == 0 {
+		permissionDenied(w)
+		return
+	}
+
+	items, err := s.store.ListTrash(userID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while listing the trash"})
+		return
+	}
+
+	for _, item := range items {
+		item.PurgeAt = item.DeletedAt.Add(Envs.TrashRetention)
+	}
+
+	WriteJSON(w, http.StatusOK, items)
+}
+
+// handleRestore takes a task or project out of the trash. Restoring needs the
+// role that deleting does.
+func (s *TrashService) handleRestore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	id, err := parseIDParam(vars["id"])
+	if err != nil || id == 0 {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidID.Error()})
+		return
+	}
+
+	switch vars["type"] {
+	case TrashTypeTask:
+		s.restoreTask(w, r, id)
+	case TrashTypeProject:
+		s.restoreProject(w, r, id)
+	default:
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidTrashType.Error()})
+	}
+}
+
+func (s *TrashService) restoreTask(w http.ResponseWriter, r *http.Request, id int64) {
+	task, err := s.store.GetDeletedTask(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "task not found in the trash"})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the task"})
+		return
+	}
+
+	if _, ok := authorizeProject(s.store, w, r, task.ProjectID, RoleMaintainer); !ok {
+		return
+	}
+
+	project, err := s.store.GetProject(strconv.FormatInt(task.ProjectID, 10))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errProjectDeleted.Error()})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the project"})
+		return
+	}
+
+	if project.ArchivedAt != nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errProjectArchived.Error()})
+		return
+	}
+
+	workflow, err := s.store.GetWorkflow(task.ProjectID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the workflow"})
+		return
+	}
+
+	// the workflow may have dropped the state the task was deleted in
+	status := task.Status
+	if workflow.State(status) == nil {
+		status = workflow.InitialState()
+	}
+
+	t, err := s.store.RestoreTask(task.ID, status, GetUserIDFromContext(r.Context()))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while restoring the task"})
+		return
+	}
+
+	w.Header().Set("ETag", taskETag(t))
+	WriteJSON(w, http.StatusOK, t)
+}
+
+func (s *TrashService) restoreProject(w http.ResponseWriter, r *http.Request, id int64) {
+	project, err := s.store.GetDeletedProject(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusNotFound, ErrorResponse{Error: "project not found in the trash"})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the project"})
+		return
+	}
+
+	if _, ok := authorizeProject(s.store, w, r, project.ID, RoleOwner); !ok {
+		return
+	}
+
+	p, err := s.store.RestoreProject(project.ID, GetUserIDFromContext(r.Context()))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while restoring the project"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, p)
+}
+
+// StartTrashPurge removes trashed items older than retention every interval,
+// for as long as the process runs.
+func StartTrashPurge(store Store, retention, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purgeTrash(store, retention)
+			<-ticker.C
+		}
+	}()
+}
+
+func purgeTrash(store Store, retention time.Duration) {
+	n, err := store.PurgeTrash(time.Now().Add(-retention))
+	if err != nil {
+		log.Println("trash purge failed:", err)
+		return
+	}
+
+	if n > 0 {
+		log.Printf("purged %d items from the trash", n)
+	}
+}
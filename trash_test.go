@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTrash(t *testing.T) {
+	store := newTestStore(t)
+
+	u, p := newTestProject(t, store)
+
+	gears, err := store.CreateTask(&CreateTaskPayload{Name: "Gears", Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oil, err := store.CreateTask(&CreateTaskPayload{Name: "Oil", Status: StatusTODO, ProjectID: p.ID, AssignedToID: u.ID}, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should hide deleted tasks", func(t *testing.T) {
+		if err := store.DeleteTask(strconv.FormatInt(gears.ID, 10), u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.GetTask(strconv.FormatInt(gears.ID, 10)); err == nil {
+			t.Error("expected the deleted task to be hidden")
+		}
+
+		service := NewTasksService(store)
+		for _, handler := range []http.HandlerFunc{service.handleGetTask, service.handleDeleteTask} {
+			req, err := http.NewRequest(http.MethodGet, "/tasks/"+strconv.FormatInt(gears.ID, 10), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/tasks/{id}", handler)
+			router.ServeHTTP(rr, withUserID(req, u.ID))
+
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+			}
+		}
+
+		tasks, err := store.GetProjectTasks(p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tasks) != 1 || tasks[0].ID != oil.ID {
+			t.Errorf("expected only task %d, got %v", oil.ID, tasks)
+		}
+
+		items, err := store.ListTrash(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].Type != TrashTypeTask || items[0].ID != gears.ID || items[0].DeletedByID != u.ID {
+			t.Fatalf("unexpected trash %v", items)
+		}
+		if time.Since(items[0].DeletedAt) > time.Minute {
+			t.Errorf("unexpected deletion time %v", items[0].DeletedAt)
+		}
+	})
+
+	t.Run("should restore deleted tasks", func(t *testing.T) {
+		task, err := store.RestoreTask(gears.ID, StatusInProgress, u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task.Status != StatusInProgress || task.Version != gears.Version+1 {
+			t.Errorf("unexpected task %+v", task)
+		}
+
+		if _, err := store.GetTask(strconv.FormatInt(gears.ID, 10)); err != nil {
+			t.Errorf("expected the task to be back, got %v", err)
+		}
+	})
+
+	t.Run("should hide the tasks of deleted projects", func(t *testing.T) {
+		if err := store.DeleteProject(strconv.FormatInt(p.ID, 10), u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.GetProject(strconv.FormatInt(p.ID, 10)); err == nil {
+			t.Error("expected the deleted project to be hidden")
+		}
+
+		page, err := store.ListTasks(&TaskListFilter{Sort: "id", Limit: 10, MemberID: u.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Tasks) != 0 {
+			t.Errorf("expected no tasks, got %d", len(page.Tasks))
+		}
+
+		if _, err := store.RestoreProject(p.ID, u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		tasks, err := store.GetProjectTasks(p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tasks) != 2 {
+			t.Errorf("expected 2 tasks, got %d", len(tasks))
+		}
+	})
+
+	t.Run("should purge items past the retention", func(t *testing.T) {
+		if err := store.DeleteTask(strconv.FormatInt(oil.ID, 10), u.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := store.PurgeTrash(time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("expected nothing to be purged, got %d", n)
+		}
+
+		if n, err = store.PurgeTrash(time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("expected 1 purged item, got %d", n)
+		}
+
+		if _, err := store.GetDeletedTask(oil.ID); err == nil {
+			t.Error("expected the task to be purged")
+		}
+	})
+}
+
+func TestRestoreFromTrash(t *testing.T) {
+	ms := &MockStore{}
+	service := NewTrashService(ms)
+
+	restore := func(url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/trash/{type}/{id}/restore", service.handleRestore)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		return rr
+	}
+
+	t.Run("should refuse unknown types", func(t *testing.T) {
+		rr := restore("/trash/comment/1/restore")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should restore tasks in a state of the workflow", func(t *testing.T) {
+		rr := restore("/trash/task/1/restore")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var task Task
+		if err := json.NewDecoder(rr.Body).Decode(&task); err != nil {
+			t.Fatal(err)
+		}
+		if task.Status != StatusTODO {
+			t.Errorf("expected status %s, got %s", StatusTODO, task.Status)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// startTwoFactorLogin answers a correct password with a challenge to pass
+// with a code, or to enroll first when the deployment requires 2FA.
+func (s *UserService) startTwoFactorLogin(w http.ResponseWriter, user *User) {
+	token, err := s.issueUserToken(user.ID, TokenPurposeLoginChallenge, Envs.LoginChallengeTTL)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while logging in"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, &LoginChallenge{
+		ChallengeToken:     token,
+		ExpiresIn:          int64(Envs.LoginChallengeTTL.Seconds()),
+		EnrollmentRequired: user.TwoFactorEnabledAt == nil,
+	})
+}
+
+// handleTwoFactorLogin completes a login with a TOTP or a recovery code. A
+// challenge is good for one attempt, and wrong codes count as failed logins.
+// Users who had to enroll confirm their first code here.
+func (s *UserService) handleTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *TwoFactorLoginPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if payload.ChallengeToken == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errTokenRequired.Error()})
+		return
+	}
+
+	if payload.Code == "" && payload.RecoveryCode == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errTwoFactorCodeRequired.Error()})
+		return
+	}
+
+	token, ok := s.consumeUserToken(w, payload.ChallengeToken, TokenPurposeLoginChallenge)
+	if !ok {
+		return
+	}
+
+	user, err := s.store.GetUserByID(strconv.FormatInt(token.UserID, 10))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while logging in"})
+		return
+	}
+
+	response := &TwoFactorLoginResponse{}
+
+	if user.TwoFactorEnabledAt == nil {
+		if user.TOTPSecret == "" {
+			WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errTwoFactorNotEnrolled.Error()})
+			return
+		}
+
+		response.RecoveryCodes, ok, err = s.confirmEnrollment(user, payload.Code)
+	} else {
+		ok, err = s.checkSecondFactor(user, payload)
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while logging in"})
+		return
+	}
+
+	subjects := loginSubjects(r, user.Email)
+
+	if !ok {
+		if err := s.recordLoginFailure(subjects, subjects[LockoutKindIP], user.ID); err != nil {
+			log.Printf("recording a failed login failed: %v", err)
+		}
+
+		WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Error: errInvalidTwoFactorCode.Error()})
+		return
+	}
+
+	if err := s.store.ClearLoginFailures(LockoutKindAccount, subjects[LockoutKindAccount]); err != nil {
+		log.Printf("clearing failed logins failed: %v", err)
+	}
+
+	response.TokenResponse, err = createAndSetAuthCookie(s.store, user.ID, "", w)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while logging in"})
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, response)
+}
+
+// handleLoginEnrollment starts the enrollment of a user who has to enroll to
+// log in. The challenge stays valid for handleTwoFactorLogin.
+func (s *UserService) handleLoginEnrollment(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *ChallengePayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	token, err := s.store.GetUserToken(hashToken(payload.ChallengeToken), TokenPurposeLoginChallenge)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidUserToken.Error()})
+		return
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while checking the token"})
+		return
+	}
+
+	user, err := s.store.GetUserByID(strconv.FormatInt(token.UserID, 10))
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the user"})
+		return
+	}
+
+	s.startEnrollment(w, user)
+}
+
+// handleEnrollTwoFactor starts the enrollment of the caller, who confirms it
+// with a first code.
+func (s *UserService) handleEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.reauthenticatePayload(w, r)
+	if !ok {
+		return
+	}
+
+	s.startEnrollment(w, user)
+}
+
+// handleConfirmTwoFactor turns 2FA on with the first code of the enrolled
+// secret and returns the recovery codes, which are not shown again.
+func (s *UserService) handleConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.loadMe(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *TwoFactorCodePayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if user.TwoFactorEnabledAt != nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errTwoFactorEnabled.Error()})
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errTwoFactorNotEnrolled.Error()})
+		return
+	}
+
+	codes, ok, err := s.confirmEnrollment(user, payload.Code)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while enabling two-factor authentication"})
+		return
+	}
+	if !ok {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidTwoFactorCode.Error()})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, &RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (s *UserService) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.reauthenticatePayload(w, r)
+	if !ok {
+		return
+	}
+
+	if Envs.TwoFactorRequired {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errTwoFactorRequired.Error()})
+		return
+	}
+
+	if err := s.store.DisableTOTP(user.ID); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while disabling two-factor authentication"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handleRegenerateRecoveryCodes replaces every recovery code of the caller,
+// used or not.
+func (s *UserService) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.reauthenticatePayload(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorEnabledAt == nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errTwoFactorNotEnabled.Error()})
+		return
+	}
+
+	codes, hashes, err := recoveryCodes()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while creating recovery codes"})
+		return
+	}
+
+	if err := s.store.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while creating recovery codes"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, &RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// startEnrollment gives the user a new secret, replacing the one of an
+// enrollment that was never confirmed.
+func (s *UserService) startEnrollment(w http.ResponseWriter, user *User) {
+	if user.TwoFactorEnabledAt != nil {
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: errTwoFactorEnabled.Error()})
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while enrolling"})
+		return
+	}
+
+	if err := s.store.SetTOTPSecret(user.ID, secret); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while enrolling"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, &TwoFactorEnrollment{Secret: secret, OTPAuthURI: totpURI(secret, user.Email)})
+}
+
+// confirmEnrollment enables 2FA when code is right for the enrolled secret
+// and returns the first recovery codes.
+func (s *UserService) confirmEnrollment(user *User, code string) ([]string, bool, error) {
+	step, ok := validateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, false, nil
+	}
+
+	codes, hashes, err := recoveryCodes()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := s.store.EnableTOTP(user.ID, step, hashes); err != nil {
+		return nil, false, err
+	}
+
+	return codes, true, nil
+}
+
+// checkSecondFactor checks the TOTP or the recovery code of the payload. Both
+// work once only.
+func (s *UserService) checkSecondFactor(user *User, payload *TwoFactorLoginPayload) (bool, error) {
+	if payload.RecoveryCode != "" {
+		return s.store.UseRecoveryCode(user.ID, hashRecoveryCode(payload.RecoveryCode))
+	}
+
+	step, ok := validateTOTP(user.TOTPSecret, payload.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return s.store.UseTOTPStep(user.ID, step)
+}
+
+func recoveryCodes() ([]string, []string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	return codes, hashes, nil
+}
+
+// reauthenticatePayload reads a ReauthenticatePayload and checks it.
+func (s *UserService) reauthenticatePayload(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, false
+	}
+
+	defer r.Body.Close()
+
+	var payload *ReauthenticatePayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return nil, false
+	}
+
+	return s.reauthenticate(w, r, payload.CurrentPassword)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	store := newTestStore(t)
+	service := NewUserService(store, NewLogMailer("", io.Discard))
+
+	router := mux.NewRouter()
+	router.HandleFunc("/users/login", service.handleUserLogin)
+	router.HandleFunc("/users/login/2fa", service.handleTwoFactorLogin)
+	router.HandleFunc("/users/login/2fa/enroll", service.handleLoginEnrollment)
+	router.HandleFunc("/users/me/2fa", service.handleEnrollTwoFactor)
+	router.HandleFunc("/users/me/2fa/confirm", service.handleConfirmTwoFactor)
+
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newUser := func(email string) *User {
+		u, err := store.CreateUser(&CreateUserPayload{Email: email, FirstName: "Ada", LastName: "Lovelace", Password: hash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.MarkEmailVerified(u.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	post := func(url string, userID int64, payload any, dst any) int {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if userID != 0 {
+			req = withUserID(req, userID)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if dst != nil && rr.Code < 300 {
+			if err := json.NewDecoder(rr.Body).Decode(dst); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rr.Code
+	}
+
+	// codes are relative to the step the test started in, so they stay right
+	// when the clock moves on to the next step
+	base := totpStep(time.Now())
+	code := func(secret string, offset int64) string {
+		c, err := totpCode(secret, base+offset, totpDigits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	challenge := func(email string) *LoginChallenge {
+		var c LoginChallenge
+		if status := post("/users/login", 0, &LoginUserPayload{Email: email, Password: "secret"}, &c); status != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+		}
+		if c.ChallengeToken == "" {
+			t.Fatal("expected a challenge token")
+		}
+		return &c
+	}
+
+	ada := newUser("ada@example.com")
+
+	var enrollment TwoFactorEnrollment
+	var codes RecoveryCodesResponse
+
+	t.Run("should enroll with a first code", func(t *testing.T) {
+		if status := post("/users/me/2fa", ada.ID, &ReauthenticatePayload{CurrentPassword: "secret"}, &enrollment); status != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+		}
+
+		if status := post("/users/me/2fa/confirm", ada.ID, &TwoFactorCodePayload{Code: code(enrollment.Secret, 5)}, nil); status != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, status)
+		}
+
+		if status := post("/users/me/2fa/confirm", ada.ID, &TwoFactorCodePayload{Code: code(enrollment.Secret, 0)}, &codes); status != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+		}
+		if len(codes.RecoveryCodes) != recoveryCodeCount {
+			t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(codes.RecoveryCodes))
+		}
+	})
+
+	t.Run("should not replay a code", func(t *testing.T) {
+		c := challenge("ada@example.com")
+		if c.EnrollmentRequired {
+			t.Error("expected no enrollment")
+		}
+
+		status := post("/users/login/2fa", 0, &TwoFactorLoginPayload{ChallengeToken: c.ChallengeToken, Code: code(enrollment.Secret, 0)}, nil)
+		if status != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, status)
+		}
+
+		status = post("/users/login/2fa", 0, &TwoFactorLoginPayload{ChallengeToken: c.ChallengeToken, Code: code(enrollment.Secret, 1)}, nil)
+		if status != http.StatusBadRequest {
+			t.Errorf("expected the challenge to be single use, got %d", status)
+		}
+	})
+
+	t.Run("should log in with a code", func(t *testing.T) {
+		var tokens TwoFactorLoginResponse
+		status := post("/users/login/2fa", 0, &TwoFactorLoginPayload{ChallengeToken: challenge("ada@example.com").ChallengeToken, Code: code(enrollment.Secret, 1)}, &tokens)
+		if status != http.StatusCreated || tokens.TokenResponse == nil || tokens.AccessToken == "" {
+			t.Errorf("expected tokens, got %d", status)
+		}
+	})
+
+	t.Run("should log in once with each recovery code", func(t *testing.T) {
+		recovery := codes.RecoveryCodes[0]
+
+		status := post("/users/login/2fa", 0, &TwoFactorLoginPayload{ChallengeToken: challenge("ada@example.com").ChallengeToken, RecoveryCode: recovery}, nil)
+		if status != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d", http.StatusCreated, status)
+		}
+
+		status = post("/users/login/2fa", 0, &TwoFactorLoginPayload{ChallengeToken: challenge("ada@example.com").ChallengeToken, RecoveryCode: recovery}, nil)
+		if status != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, status)
+		}
+	})
+
+	t.Run("should make users enroll when 2FA is required", func(t *testing.T) {
+		Envs.TwoFactorRequired = true
+		defer func() { Envs.TwoFactorRequired = false }()
+
+		newUser("grace@example.com")
+
+		c := challenge("grace@example.com")
+		if !c.EnrollmentRequired {
+			t.Fatal("expected an enrollment")
+		}
+
+		var e TwoFactorEnrollment
+		if status := post("/users/login/2fa/enroll", 0, &ChallengePayload{ChallengeToken: c.ChallengeToken}, &e); status != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, status)
+		}
+
+		var tokens TwoFactorLoginResponse
+		status := post("/users/login/2fa", 0, &TwoFactorLoginPayload{ChallengeToken: c.ChallengeToken, Code: code(e.Secret, 0)}, &tokens)
+		if status != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, status)
+		}
+		if tokens.AccessToken == "" || len(tokens.RecoveryCodes) != recoveryCodeCount {
+			t.Errorf("expected tokens and recovery codes, got %+v", tokens)
+		}
+	})
+
+	t.Run("should not clear failures before the second factor", func(t *testing.T) {
+		// the password alone does not reset the count of wrong codes
+		locked := false
+		for i := 0; i <= Envs.LoginMaxFailures && !locked; i++ {
+			var c LoginChallenge
+			switch post("/users/login", 0, &LoginUserPayload{Email: "ada@example.com", Password: "secret"}, &c) {
+			case http.StatusTooManyRequests:
+				locked = true
+			case http.StatusOK:
+				post("/users/login/2fa", 0, &TwoFactorLoginPayload{ChallengeToken: c.ChallengeToken, Code: code(enrollment.Secret, 100)}, nil)
+			}
+		}
+
+		if !locked {
+			t.Error("expected wrong codes to lock the account")
+		}
+	})
+}
@@ -11,16 +11,102 @@ type CreateTaskPayload struct {
 	Status       string `json:"status"`
 	ProjectID    int64  `json:"projectId"`
 	AssignedToID int64  `json:"assignedToId"`
+	ParentID     int64  `json:"parentId,omitempty"`
+	TaskDetails
 }
 
 type EditTaskPayload struct {
 	Name         string `json:"name"`
 	Status       string `json:"status"`
 	AssignedToID int64  `json:"assignedToId"`
+	TaskDetails
+}
+
+// TaskDetails are the planning fields of a task. Description is markdown and
+// the estimate is in story points.
+type TaskDetails struct {
+	Description      string     `json:"description"`
+	Priority         string     `json:"priority"`
+	StartDate        *time.Time `json:"startDate,omitempty"`
+	DueDate          *time.Time `json:"dueDate,omitempty"`
+	Estimate         *int       `json:"estimate,omitempty"`
+	TimeSpentMinutes int        `json:"timeSpentMinutes"`
+}
+
+type TaskListFilter struct {
+	Statuses      []string
+	ProjectID     int64
+	MemberID      int64
+	AssignedToID  int64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Priorities    []string
+	DueAfter      *time.Time
+	DueBefore     *time.Time
+	// LabelsAny, LabelsAll and LabelsNone filter on label ids.
+	LabelsAny  []int64
+	LabelsAll  []int64
+	LabelsNone []int64
+	Sort       string
+	Desc       bool
+	Limit      int
+	Cursor     *cursor
+}
+
+type TaskPage struct {
+	Tasks      []*Task `json:"tasks"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+type BoardColumn struct {
+	Status string  `json:"status"`
+	Count  int     `json:"count"`
+	Tasks  []*Task `json:"tasks"`
+}
+
+type ProjectBoard struct {
+	Project *Project       `json:"project"`
+	Columns []*BoardColumn `json:"columns"`
+}
+
+// WorkflowState is one status tasks of a project can be in. States are
+// ordered as they appear on the board. Terminal states count as closed for
+// blockers and subtask progress, tasks leave them like any other state.
+type WorkflowState struct {
+	Name     string `json:"name"`
+	Initial  bool   `json:"initial"`
+	Terminal bool   `json:"terminal"`
+}
+
+type WorkflowTransition struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Workflow struct {
+	ProjectID   int64                 `json:"projectId"`
+	States      []*WorkflowState      `json:"states"`
+	Transitions []*WorkflowTransition `json:"transitions"`
+	// Default is set when the project has no workflow of its own.
+	Default bool `json:"default"`
+}
+
+type WorkflowPayload struct {
+	States      []*WorkflowState      `json:"states"`
+	Transitions []*WorkflowTransition `json:"transitions"`
 }
 
 type CreateProjectPayload struct {
-	Name         string    `json:"name"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// EditProjectPayload replaces the editable fields of a project. Changing the
+// owner requires the owner role.
+type EditProjectPayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	OwnerID     int64  `json:"ownerId"`
 }
 
 type CreateUserPayload struct {
@@ -35,26 +121,397 @@ type LoginUserPayload struct {
 	Password  string    `json:"password"`
 }
 
+type LogoutPayload struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
+
+// LoginChallenge is the answer to a correct password when a second factor is
+// needed. EnrollmentRequired is set for users who have to enroll first.
+type LoginChallenge struct {
+	ChallengeToken     string `json:"challengeToken"`
+	ExpiresIn          int64  `json:"expiresIn"`
+	EnrollmentRequired bool   `json:"enrollmentRequired,omitempty"`
+}
+
+// TwoFactorLoginPayload completes a login with either a TOTP code or a
+// recovery code.
+type TwoFactorLoginPayload struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// TwoFactorLoginResponse carries the recovery codes when the login also
+// completed an enrollment.
+type TwoFactorLoginResponse struct {
+	*TokenResponse
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+type ChallengePayload struct {
+	ChallengeToken string `json:"challengeToken"`
+}
+
+type TwoFactorCodePayload struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// AccessToken is a personal access token. The token itself is only returned
+// when it is created, Prefix is kept to tell tokens apart.
+type AccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type CreateAccessTokenPayload struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type CreatedAccessToken struct {
+	*AccessToken
+	Token string `json:"token"`
+}
+
+// OIDCLogin is a single sign-on login waiting for the callback of the
+// identity provider, found by the hash of its state.
+type OIDCLogin struct {
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+// UserIdentity links a user to the subject of an identity provider.
+type UserIdentity struct {
+	ID        int64
+	UserID    int64
+	Issuer    string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// RefreshToken is the server side record of a refresh token. Only the hash
+// of the token is stored. Tokens issued by rotating one another share a
+// family, so a replayed token can revoke every token derived from it.
+type RefreshToken struct {
+	ID        string
+	UserID    int64
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// UserToken is a single use token mailed to a user, to verify their email or
+// reset their password. Only its hash is stored.
+type UserToken struct {
+	ID        int64
+	UserID    int64
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// Lockout is a temporary lockout of an account or a client IP after too many
+// failed logins. UserID is 0 for IPs and for emails without an account.
+type Lockout struct {
+	ID          int64      `json:"id"`
+	Kind        string     `json:"kind"`
+	Subject     string     `json:"subject"`
+	UserID      int64      `json:"userId,omitempty"`
+	IP          string     `json:"ip"`
+	Failures    int        `json:"failures"`
+	LockedUntil time.Time  `json:"lockedUntil"`
+	ClearedAt   *time.Time `json:"clearedAt,omitempty"`
+	ClearedByID int64      `json:"clearedById,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+type LockoutPage struct {
+	Lockouts   []*Lockout `json:"lockouts"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
 type Project struct {
-	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	OwnerID     int64     `json:"ownerId"`
+	CreatedByID int64     `json:"createdById"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// ArchivedAt is set while the project is archived.
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+}
+
+type ProjectMember struct {
+	ProjectID int64     `json:"projectId"`
+	UserID    int64     `json:"userId"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type AddProjectMemberPayload struct {
+	UserID int64  `json:"userId"`
+	Role   string `json:"role"`
+}
+
+type UpdateProjectMemberPayload struct {
+	Role string `json:"role"`
 }
 
 type Task struct {
-	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	Status       string    `json:"status"`
-	ProjectID    int64     `json:"projectId"`
-	AssignedToID int64     `json:"assignedToId"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	ProjectID    int64  `json:"projectId"`
+	AssignedToID int64  `json:"assignedToId"`
+	CreatedByID  int64  `json:"createdById"`
+	ParentID     int64  `json:"parentId,omitempty"`
+	// Version is bumped on every update, it is the ETag of the task.
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	TaskDetails
+	// Labels and Progress are only set on single task reads, Progress rolls
+	// up the subtasks.
+	Labels   []*Label      `json:"labels,omitempty"`
+	Progress *TaskProgress `json:"progress,omitempty"`
 }
 
-type User struct {
+// TaskProgress counts the subtasks of a task that reached a terminal state.
+type TaskProgress struct {
+	Total   int `json:"total"`
+	Done    int `json:"done"`
+	Percent int `json:"percent"`
+}
+
+type SubtaskList struct {
+	Subtasks []*Task       `json:"subtasks"`
+	Progress *TaskProgress `json:"progress"`
+}
+
+type TaskDependencies struct {
+	BlockedBy []*Task `json:"blockedBy"`
+	Blocks    []*Task `json:"blocks"`
+}
+
+type TaskParentPayload struct {
+	ParentID int64 `json:"parentId"`
+}
+
+type TaskDependencyPayload struct {
+	BlockerID int64 `json:"blockerId"`
+}
+
+// Label is a project-scoped tag, Color is a #rrggbb hex colour.
+type Label struct {
 	ID        int64     `json:"id"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Password  string    `json:"password"`
+	ProjectID int64     `json:"projectId"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
 	CreatedAt time.Time `json:"createdAt"`
 }
+
+type LabelPayload struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type TaskLabelPayload struct {
+	LabelID int64 `json:"labelId"`
+}
+
+// Comment bodies are markdown, rendering is left to the clients.
+type Comment struct {
+	ID        int64      `json:"id"`
+	TaskID    int64      `json:"taskId"`
+	AuthorID  int64      `json:"authorId"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+type CommentPayload struct {
+	Body string `json:"body"`
+}
+
+type UpdateProfilePayload struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// ChangeEmailPayload and the payloads below carry the current password, the
+// caller signs in again to change credentials or delete the account.
+type ChangeEmailPayload struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"currentPassword"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type VerifyEmailPayload struct {
+	Token string `json:"token"`
+}
+
+// EmailPayload asks for a verification or password reset email.
+type EmailPayload struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordPayload struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+type DeleteAccountPayload struct {
+	CurrentPassword string `json:"currentPassword"`
+}
+
+// ReauthenticatePayload confirms a security setting change with the password.
+type ReauthenticatePayload struct {
+	CurrentPassword string `json:"currentPassword"`
+}
+
+type UserPage struct {
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+type CommentPage struct {
+	Comments   []*Comment `json:"comments"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// TrashItem is a deleted task or project that can still be restored.
+type TrashItem struct {
+	Type        string    `json:"type"`
+	ID          int64     `json:"id"`
+	ProjectID   int64     `json:"projectId"`
+	Name        string    `json:"name"`
+	DeletedAt   time.Time `json:"deletedAt"`
+	DeletedByID int64     `json:"deletedById,omitempty"`
+	// PurgeAt is when the purge job removes the item for good.
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// SearchDocument is the searchable text of a task, project or comment.
+type SearchDocument struct {
+	Kind      string
+	ID        int64
+	ProjectID int64
+	TaskID    int64
+	Title     string
+	Body      string
+}
+
+type SearchQuery struct {
+	Text string
+	// Kinds limits the results to tasks, projects or comments, all when empty.
+	Kinds []string
+	// ProjectIDs are the projects the caller may see.
+	ProjectIDs []int64
+	Limit      int
+}
+
+// SearchResult is a matching document. Highlight is an HTML escaped snippet
+// with the matched terms wrapped in <mark>.
+type SearchResult struct {
+	Kind      string  `json:"kind"`
+	ID        int64   `json:"id"`
+	ProjectID int64   `json:"projectId"`
+	TaskID    int64   `json:"taskId,omitempty"`
+	Title     string  `json:"title,omitempty"`
+	Highlight string  `json:"highlight"`
+	Score     float64 `json:"score"`
+}
+
+type SearchResponse struct {
+	Results []*SearchResult `json:"results"`
+}
+
+// Event is an entry of the audit trail. Events are only ever appended.
+type Event struct {
+	ID         int64          `json:"id"`
+	ProjectID  int64          `json:"projectId"`
+	TaskID     int64          `json:"taskId,omitempty"`
+	ActorID    int64          `json:"actorId"`
+	EntityType string         `json:"entityType"`
+	Action     string         `json:"action"`
+	Changes    []*FieldChange `json:"changes"`
+	CreatedAt  time.Time      `json:"createdAt"`
+}
+
+// FieldChange is the value of one field before and after an event. From is
+// nil for created entities and To for deleted ones.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+type EventFilter struct {
+	ProjectID int64
+	TaskID    int64
+	BeforeID  int64
+	Limit     int
+}
+
+type EventPage struct {
+	Events     []*Event `json:"events"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+type User struct {
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	FirstName       string     `json:"firstName"`
+	LastName        string     `json:"lastName"`
+	Password        string     `json:"-"`
+	Role            string     `json:"role"`
+	// TokensRevokedAt invalidates the tokens issued before it, see logout-all.
+	TokensRevokedAt *time.Time `json:"-"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	// TOTPSecret is set from the start of the enrollment, two-factor login is
+	// only on once TwoFactorEnabledAt is.
+	TOTPSecret         string     `json:"-"`
+	TwoFactorEnabledAt *time.Time `json:"twoFactorEnabledAt"`
+	CreatedAt          time.Time  `json:"createdAt"`
+}
@@ -1,25 +1,55 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
+	"log"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService struct {
-	store Store
+	store  Store
+	mailer Mailer
+	// mails tracks the emails sent off the request path
+	mails sync.WaitGroup
 }
 
-func NewUserService(s Store) *UserService {
-	return &UserService{store: s}
+func NewUserService(s Store, mailer Mailer) *UserService {
+	return &UserService{store: s, mailer: mailer}
 }
 
 func (s *UserService) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/users/register", s.handleUserRegister).Methods("POST")
 	r.HandleFunc("/users/login", s.handleUserLogin).Methods("POST")
+	r.HandleFunc("/users/login/2fa", s.handleTwoFactorLogin).Methods("POST")
+	r.HandleFunc("/users/login/2fa/enroll", s.handleLoginEnrollment).Methods("POST")
+	r.HandleFunc("/users/refresh", s.handleRefreshToken).Methods("POST")
+	r.HandleFunc("/users/verify", s.handleVerifyEmail).Methods("POST")
+	r.HandleFunc("/users/verify/resend", s.handleResendVerification).Methods("POST")
+	r.HandleFunc("/users/password/forgot", s.handleForgotPassword).Methods("POST")
+	r.HandleFunc("/users/password/reset", s.handleResetPassword).Methods("POST")
+	r.HandleFunc("/users/logout", WithJWTAuth(s.handleLogout, s.store)).Methods("POST")
+	r.HandleFunc("/users/logout-all", WithJWTAuth(s.handleLogoutAll, s.store)).Methods("POST")
+	r.HandleFunc("/users", WithJWTAuth(s.handleListUsers, s.store)).Methods("GET")
+	r.HandleFunc("/users/me", WithJWTAuth(s.handleGetMe, s.store)).Methods("GET")
+	r.HandleFunc("/users/me", WithJWTAuth(s.handleUpdateMe, s.store)).Methods("PATCH")
+	r.HandleFunc("/users/me", WithJWTAuth(s.handleDeleteMe, s.store)).Methods("DELETE")
+	r.HandleFunc("/users/me/email", WithJWTAuth(s.handleChangeEmail, s.store)).Methods("PUT")
+	r.HandleFunc("/users/me/password", WithJWTAuth(s.handleChangePassword, s.store)).Methods("PUT")
+	r.HandleFunc("/users/me/tokens", WithJWTAuth(s.handleGetAccessTokens, s.store)).Methods("GET")
+	r.HandleFunc("/users/me/tokens", WithJWTAuth(s.handleCreateAccessToken, s.store)).Methods("POST")
+	r.HandleFunc("/users/me/tokens/{id}", WithJWTAuth(s.handleRevokeAccessToken, s.store)).Methods("DELETE")
+	r.HandleFunc("/users/me/2fa", WithJWTAuth(s.handleEnrollTwoFactor, s.store)).Methods("POST")
+	r.HandleFunc("/users/me/2fa", WithJWTAuth(s.handleDisableTwoFactor, s.store)).Methods("DELETE")
+	r.HandleFunc("/users/me/2fa/confirm", WithJWTAuth(s.handleConfirmTwoFactor, s.store)).Methods("POST")
+	r.HandleFunc("/users/me/2fa/recovery-codes", WithJWTAuth(s.handleRegenerateRecoveryCodes, s.store)).Methods("POST")
 }
 
 func (s *UserService) handleUserRegister(w http.ResponseWriter, r *http.Request) {
@@ -56,13 +86,13 @@ func (s *UserService) handleUserRegister(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := createAndSetAuthCookie(u.ID, w)
-	if err != nil {
-		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error creating user"})
-		return
+	// the user can log in once the email is verified, and can ask for
+	// another link if this one never arrives
+	if err := s.sendVerificationEmail(u); err != nil {
+		log.Printf("sending a verification email to user %d failed: %v", u.ID, err)
 	}
 
-	WriteJSON(w, http.StatusCreated, token)
+	WriteJSON(w, http.StatusCreated, u)
 }
 
 func (s *UserService) handleUserLogin(w http.ResponseWriter, r *http.Request) {
@@ -86,27 +116,69 @@ func (s *UserService) handleUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 1. Find user in db by email
-	user, err := s.store.GetUserByEmail(loginPayload.Email)
+	// 1. Refuse locked accounts and IPs before looking at the password
+	subjects := loginSubjects(r, loginPayload.Email)
+
+	until, err := s.loginLockedUntil(subjects)
 	if err != nil {
-		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "User doesn't exist"})
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while logging in"})
+		return
+	}
+	if time.Now().Before(until) {
+		tooManyLogins(w, until)
+		return
+	}
+
+	// 2. Find user in db by email
+	user, err := s.store.GetUserByEmail(loginPayload.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while logging in"})
 		return
 	}
-	
-	// 2. Compare password with hashed password
-	if !user.validatePassword(loginPayload.Password){
-		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Not authenticated"})
+
+	// 3. Compare password with hashed password, unknown emails take as long
+	// and fail the same way as wrong passwords
+	var valid bool
+	if err == nil {
+		valid = user.validatePassword(loginPayload.Password)
+	} else {
+		compareDummyPassword(loginPayload.Password)
+		user = &User{}
+	}
+
+	if !valid {
+		if err := s.recordLoginFailure(subjects, subjects[LockoutKindIP], user.ID); err != nil {
+			log.Printf("recording a failed login failed: %v", err)
+		}
+
+		WriteJSON(w, http.StatusUnauthorized, ErrorResponse{Error: errInvalidCredentials.Error()})
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		WriteJSON(w, http.StatusForbidden, ErrorResponse{Error: errEmailNotVerified.Error()})
+		return
+	}
+
+	// 4. Ask for the second factor before issuing tokens
+	if user.TwoFactorEnabledAt != nil || Envs.TwoFactorRequired {
+		s.startTwoFactorLogin(w, user)
 		return
 	}
 
-	// 3. Create JWT and set it in a cookie
-	token, err := createAndSetAuthCookie(user.ID, w)
+	// the login is complete, the second factor clears the failures itself
+	if err := s.store.ClearLoginFailures(LockoutKindAccount, subjects[LockoutKindAccount]); err != nil {
+		log.Printf("clearing failed logins failed: %v", err)
+	}
+
+	// 5. Create JWT and set it in a cookie
+	token, err := createAndSetAuthCookie(s.store, user.ID, "", w)
 	if err != nil {
 		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Not authenticatedr"})
 		return
 	}
 
-	// 4. Return JWT in response
+	// 6. Return JWT in response
 	WriteJSON(w, http.StatusCreated, token)
 }
 
@@ -142,19 +214,22 @@ func validateLoginPayload(user *LoginUserPayload) error {
 	return nil
 }
 
-func createAndSetAuthCookie(userID int64, w http.ResponseWriter) (string, error) {
-	secret := []byte(Envs.JWTSecret)
-	token, err := CreateJWT(secret, userID)
+// createAndSetAuthCookie issues a token pair in the given refresh token family
+// and sets the access token as a cookie.
+func createAndSetAuthCookie(store Store, userID int64, familyID string, w http.ResponseWriter) (*TokenResponse, error) {
+	tokens, err := issueTokens(store, userID, familyID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	http.SetCookie(w, &http.Cookie{
-		Name:  "Authorization",
-		Value: token,
+		Name:     "Authorization",
+		Value:    tokens.AccessToken,
+		MaxAge:   int(Envs.AccessTokenTTL.Seconds()),
+		HttpOnly: true,
 	})
 
-	return token, nil
+	return tokens, nil
 }
 
 func (u *User) validatePassword(password string) bool {
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TokenPurposeVerifyEmail    = "verify_email"
+	TokenPurposeResetPassword  = "reset_password"
+	TokenPurposeLoginChallenge = "login_challenge"
+)
+
+// Emails sent on request are counted against the address and the client IP.
+const (
+	MailThrottleKindEmail = "mail_email"
+	MailThrottleKindIP    = "mail_ip"
+)
+
+// handleVerifyEmail confirms the address a verification email was sent to.
+func (s *UserService) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *VerifyEmailPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if payload.Token == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errTokenRequired.Error()})
+		return
+	}
+
+	token, ok := s.consumeUserToken(w, payload.Token, TokenPurposeVerifyEmail)
+	if !ok {
+		return
+	}
+
+	if err := s.store.MarkEmailVerified(token.UserID, time.Now()); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while verifying the email"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handleResendVerification mails a new verification link. It answers the same
+// whether or not the email belongs to an account.
+func (s *UserService) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	email, ok := readEmailPayload(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.checkMailThrottle(w, r, email) {
+		return
+	}
+
+	s.mailInBackground(email, func(user *User) error {
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+		return s.sendVerificationEmail(user)
+	})
+
+	WriteJSON(w, http.StatusAccepted, nil)
+}
+
+// handleForgotPassword mails a password reset link. It answers the same
+// whether or not the email belongs to an account.
+func (s *UserService) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	email, ok := readEmailPayload(w, r)
+	if !ok {
+		return
+	}
+
+	if !s.checkMailThrottle(w, r, email) {
+		return
+	}
+
+	s.mailInBackground(email, s.sendPasswordResetEmail)
+
+	WriteJSON(w, http.StatusAccepted, nil)
+}
+
+// mailInBackground looks the address up and mails its owner off the request
+// path, so the answer takes as long whether or not the address has an account.
+func (s *UserService) mailInBackground(email string, send func(user *User) error) {
+	s.mails.Add(1)
+	go func() {
+		defer s.mails.Done()
+
+		user, err := s.store.GetUserByEmail(email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err == nil {
+			err = send(user)
+		}
+		if err != nil {
+			log.Println("sending an email on request failed:", err)
+		}
+	}()
+}
+
+// checkMailThrottle counts a request for an email against the address and the
+// client IP, and answers 429 once either sent too many within
+// MAIL_THROTTLE_WINDOW. Unknown addresses are counted the same way.
+func (s *UserService) checkMailThrottle(w http.ResponseWriter, r *http.Request, email string) bool {
+	limits := []struct {
+		kind, subject string
+		max           int
+	}{
+		{MailThrottleKindEmail, strings.ToLower(strings.TrimSpace(email)), Envs.MailMaxPerEmail},
+		{MailThrottleKindIP, clientIP(r), Envs.MailMaxPerIP},
+	}
+
+	for _, l := range limits {
+		sent, err := s.store.RecordMailRequest(l.kind, l.subject, time.Now(), Envs.MailThrottleWindow)
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while sending the email"})
+			return false
+		}
+
+		if sent > l.max {
+			w.Header().Set("Retry-After", strconv.Itoa(int(Envs.MailThrottleWindow.Seconds())))
+			WriteJSON(w, http.StatusTooManyRequests, ErrorResponse{Error: errTooManyEmails.Error()})
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleResetPassword sets a new password with the token of a reset email
+// and signs the user out everywhere, personal access tokens included.
+// Receiving the email proves the address, so it also counts as verifying it.
+func (s *UserService) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *ResetPasswordPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if payload.Token == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errTokenRequired.Error()})
+		return
+	}
+
+	if payload.NewPassword == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errPasswordRequired.Error()})
+		return
+	}
+
+	hashedPassword, err := HashPassword(payload.NewPassword)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while resetting the password"})
+		return
+	}
+
+	token, ok := s.consumeUserToken(w, payload.Token, TokenPurposeResetPassword)
+	if !ok {
+		return
+	}
+
+	if err := s.store.UpdateUserPassword(token.UserID, hashedPassword); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while resetting the password"})
+		return
+	}
+
+	now := time.Now()
+
+	if err := s.store.MarkEmailVerified(token.UserID, now); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while resetting the password"})
+		return
+	}
+
+	if err := s.store.RevokeUserTokens(token.UserID, now); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while revoking sessions"})
+		return
+	}
+
+	WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (s *UserService) consumeUserToken(w http.ResponseWriter, value, purpose string) (*UserToken, bool) {
+	token, err := s.store.ConsumeUserToken(hashToken(value), purpose)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errInvalidUserToken.Error()})
+		return nil, false
+	}
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while checking the token"})
+		return nil, false
+	}
+
+	return token, true
+}
+
+func (s *UserService) sendVerificationEmail(user *User) error {
+	token, err := s.issueUserToken(user.ID, TokenPurposeVerifyEmail, Envs.EmailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(&Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hi %s,\n\nconfirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n",
+			user.FirstName, appLink("/verify-email", token), Envs.EmailVerifyTTL),
+	})
+}
+
+func (s *UserService) sendPasswordResetEmail(user *User) error {
+	token, err := s.issueUserToken(user.ID, TokenPurposeResetPassword, Envs.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(&Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nchoose a new password by opening this link:\n\n%s\n\nThe link expires in %s. If you did not ask for it, ignore this email.\n",
+			user.FirstName, appLink("/reset-password", token), Envs.PasswordResetTTL),
+	})
+}
+
+// issueUserToken stores the hash of a new token and returns the token, which
+// only the recipient ever sees.
+func (s *UserService) issueUserToken(userID int64, purpose string, ttl time.Duration) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.store.CreateUserToken(&UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// appLink points at a page of the web app that posts the token back to us.
+func appLink(path, token string) string {
+	return strings.TrimRight(Envs.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func readEmailPayload(w http.ResponseWriter, r *http.Request) (string, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return "", false
+	}
+
+	defer r.Body.Close()
+
+	var payload *EmailPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil || payload == nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return "", false
+	}
+
+	email := strings.TrimSpace(payload.Email)
+	if email == "" {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: errEmailRequired.Error()})
+		return "", false
+	}
+
+	return email, true
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var mailedToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestEmailVerification(t *testing.T) {
+	store := newTestStore(t)
+	outbox := &bytes.Buffer{}
+	service := NewUserService(store, NewLogMailer("test@example.com", outbox))
+
+	router := mux.NewRouter()
+	service.RegisterRoutes(router)
+
+	post := func(url, payload string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	lastToken := func() string {
+		service.mails.Wait()
+		matches := mailedToken.FindAllStringSubmatch(outbox.String(), -1)
+		if len(matches) == 0 {
+			t.Fatalf("expected a token in %q", outbox.String())
+		}
+		return matches[len(matches)-1][1]
+	}
+
+	login := `{"email":"ada@example.com","password":"secret"}`
+
+	t.Run("should not log in before verifying", func(t *testing.T) {
+		rr := post("/users/register", `{"email":"ada@example.com","firstName":"Ada","lastName":"Lovelace","password":"secret"}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if bytes.Contains(rr.Body.Bytes(), []byte("accessToken")) {
+			t.Error("expected no tokens before the email is verified")
+		}
+
+		if rr := post("/users/login", login); rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should only accept the latest link", func(t *testing.T) {
+		first := lastToken()
+
+		if rr := post("/users/verify/resend", `{"email":"ada@example.com"}`); rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+		if first == lastToken() {
+			t.Fatal("expected a new token")
+		}
+
+		if rr := post("/users/verify", `{"token":"`+first+`"}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should log in once verified", func(t *testing.T) {
+		token := lastToken()
+
+		if rr := post("/users/verify", `{"token":"`+token+`"}`); rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		if rr := post("/users/verify", `{"token":"`+token+`"}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected the token to be single use, got %d", rr.Code)
+		}
+
+		if rr := post("/users/login", login); rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+	})
+
+	t.Run("should not tell whether an email exists", func(t *testing.T) {
+		sent := outbox.Len()
+
+		for _, url := range []string{"/users/verify/resend", "/users/password/forgot"} {
+			if rr := post(url, `{"email":"nobody@example.com"}`); rr.Code != http.StatusAccepted {
+				t.Errorf("expected status code %d for %s, got %d", http.StatusAccepted, url, rr.Code)
+			}
+		}
+
+		service.mails.Wait()
+		if outbox.Len() != sent {
+			t.Error("expected no email to be sent")
+		}
+	})
+
+	t.Run("should reset the password", func(t *testing.T) {
+		if rr := post("/users/password/forgot", `{"email":"ada@example.com"}`); rr.Code != http.StatusAccepted {
+			t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+		token := lastToken()
+
+		if rr := post("/users/verify", `{"token":"`+token+`"}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected reset tokens not to verify emails, got %d", rr.Code)
+		}
+
+		if rr := post("/users/password/reset", `{"token":"`+token+`","newPassword":"better"}`); rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		if rr := post("/users/password/reset", `{"token":"`+token+`","newPassword":"worse"}`); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected the token to be single use, got %d", rr.Code)
+		}
+
+		if rr := post("/users/login", login); rr.Code == http.StatusCreated {
+			t.Error("expected the old password to be refused")
+		}
+		if rr := post("/users/login", `{"email":"ada@example.com","password":"better"}`); rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+	})
+
+	t.Run("should throttle emails to an address", func(t *testing.T) {
+		for i := 0; i < Envs.MailMaxPerEmail; i++ {
+			if rr := post("/users/password/forgot", `{"email":"grace@example.com"}`); rr.Code != http.StatusAccepted {
+				t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+			}
+		}
+
+		rr := post("/users/verify/resend", `{"email":"GRACE@example.com"}`)
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status code %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+	})
+}
+
+func TestUserTokens(t *testing.T) {
+	store := newTestStore(t)
+
+	u := newTestUser(t, store)
+
+	t.Run("should refuse expired tokens", func(t *testing.T) {
+		err := store.CreateUserToken(&UserToken{UserID: u.ID, Purpose: TokenPurposeResetPassword, TokenHash: hashToken("old"), ExpiresAt: time.Now().Add(-time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.ConsumeUserToken(hashToken("old"), TokenPurposeResetPassword); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("should reset verification when the email changes", func(t *testing.T) {
+		if err := store.MarkEmailVerified(u.ID, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.UpdateUserEmail(u.ID, "ada@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		user, err := store.GetUserByEmail("ada@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.EmailVerifiedAt == nil {
+			t.Error("expected the same email to stay verified")
+		}
+
+		if err := store.UpdateUserEmail(u.ID, "lovelace@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if user, err = store.GetUserByEmail("lovelace@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if user.EmailVerifiedAt != nil {
+			t.Error("expected the new email to need verification")
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultWorkflow is used by projects that did not define their own. It has
+// the four historical statuses and allows moving between any of them.
+func DefaultWorkflow(projectID int64) *Workflow {
+	w := &Workflow{ProjectID: projectID, Default: true}
+
+	for i, status := range defaultStatuses {
+		w.States = append(w.States, &WorkflowState{
+			Name:     status,
+			Initial:  i == 0,
+			Terminal: status == StatusDone,
+		})
+	}
+
+	for _, from := range defaultStatuses {
+		for _, to := range defaultStatuses {
+			if from != to {
+				w.Transitions = append(w.Transitions, &WorkflowTransition{From: from, To: to})
+			}
+		}
+	}
+
+	return w
+}
+
+func (w *Workflow) State(name string) *WorkflowState {
+	for _, state := range w.States {
+		if state.Name == name {
+			return state
+		}
+	}
+
+	return nil
+}
+
+func (w *Workflow) InitialState() string {
+	for _, state := range w.States {
+		if state.Initial {
+			return state.Name
+		}
+	}
+
+	return ""
+}
+
+// CanTransition reports whether a task may move from one state to the other.
+// Staying in the same state is always allowed.
+func (w *Workflow) CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+
+	for _, t := range w.Transitions {
+		if t.From == from && t.To == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkTransition returns a descriptive error when the task cannot move to
+// the given state.
+func (w *Workflow) checkTransition(from, to string) error {
+	if w.State(to) == nil {
+		return fmt.Errorf("%w: %q is not a state of the project workflow", invalidStatus, to)
+	}
+
+	if w.CanTransition(from, to) {
+		return nil
+	}
+
+	allowed := []string{}
+	for _, t := range w.Transitions {
+		if t.From == from {
+			allowed = append(allowed, t.To)
+		}
+	}
+
+	if len(allowed) == 0 {
+		return fmt.Errorf("%w: %s is a final state", errTransitionNotAllowed, from)
+	}
+
+	return fmt.Errorf("%w: %s to %s, %s can move to %s", errTransitionNotAllowed, from, to, from, strings.Join(allowed, ", "))
+}
+
+func (s *ProjectService) handleGetWorkflow(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	workflow, err := s.store.GetWorkflow(project.ID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while loading the workflow"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, workflow)
+}
+
+func (s *ProjectService) handleUpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	defer r.Body.Close()
+
+	var payload *WorkflowPayload
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request payload"})
+		return
+	}
+
+	if err := validateWorkflowPayload(payload); err != nil {
+		WriteJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	workflow := &Workflow{ProjectID: project.ID, States: payload.States, Transitions: payload.Transitions}
+	if !s.checkStatesInUse(w, workflow) {
+		return
+	}
+
+	if err := s.store.SaveWorkflow(workflow); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while saving the workflow"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, workflow)
+}
+
+// handleDeleteWorkflow puts the project back on the default workflow.
+func (s *ProjectService) handleDeleteWorkflow(w http.ResponseWriter, r *http.Request) {
+	project, _, ok := s.loadProject(w, r, RoleMaintainer)
+	if !ok {
+		return
+	}
+
+	workflow := DefaultWorkflow(project.ID)
+	if !s.checkStatesInUse(w, workflow) {
+		return
+	}
+
+	if err := s.store.DeleteWorkflow(project.ID); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while deleting the workflow"})
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, workflow)
+}
+
+// checkStatesInUse refuses workflows that would leave tasks in a state that
+// no longer exists.
+func (s *ProjectService) checkStatesInUse(w http.ResponseWriter, workflow *Workflow) bool {
+	counts, err := s.store.CountTasksByStatus(workflow.ProjectID)
+	if err != nil {
+		WriteJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Error while checking task statuses"})
+		return false
+	}
+
+	missing := []string{}
+	for status := range counts {
+		if workflow.State(status) == nil {
+			missing = append(missing, status)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		WriteJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("%s: %s", errStatesInUse, strings.Join(missing, ", "))})
+		return false
+	}
+
+	return true
+}
+
+func validateWorkflowPayload(w *WorkflowPayload) error {
+	if len(w.States) == 0 {
+		return errStatesRequired
+	}
+
+	names := map[string]bool{}
+	initial, terminal := 0, 0
+
+	for _, state := range w.States {
+		if state == nil {
+			return errStatesRequired
+		}
+		if err := validateStatus(state.Name); err != nil {
+			return fmt.Errorf("%w: %q", err, state.Name)
+		}
+		if names[state.Name] {
+			return fmt.Errorf("%w: %s", errDuplicateState, state.Name)
+		}
+		names[state.Name] = true
+
+		if state.Initial {
+			initial++
+		}
+		if state.Terminal {
+			terminal++
+		}
+	}
+
+	if initial != 1 {
+		return errInitialState
+	}
+
+	if terminal == 0 {
+		return errTerminalState
+	}
+
+	seen := map[WorkflowTransition]bool{}
+	for _, t := range w.Transitions {
+		if t == nil || !names[t.From] || !names[t.To] || t.From == t.To {
+			return errInvalidTransition
+		}
+		if seen[*t] {
+			return fmt.Errorf("%w: %s to %s is listed twice", errInvalidTransition, t.From, t.To)
+		}
+		seen[*t] = true
+	}
+
+	return nil
+}
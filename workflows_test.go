@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidateWorkflowPayload(t *testing.T) {
+	valid := func() *WorkflowPayload {
+		return &WorkflowPayload{
+			States: []*WorkflowState{
+				{Name: "OPEN", Initial: true},
+				{Name: "IN_REVIEW"},
+				{Name: "CLOSED", Terminal: true},
+			},
+			Transitions: []*WorkflowTransition{
+				{From: "OPEN", To: "IN_REVIEW"},
+				{From: "IN_REVIEW", To: "CLOSED"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *WorkflowPayload)
+		err    error
+	}{
+		{"valid", func(p *WorkflowPayload) {}, nil},
+		{"no states", func(p *WorkflowPayload) { p.States = nil }, errStatesRequired},
+		{"malformed name", func(p *WorkflowPayload) { p.States[1].Name = "in review" }, invalidStatus},
+		{"duplicate state", func(p *WorkflowPayload) { p.States[1].Name = "OPEN" }, errDuplicateState},
+		{"two initial states", func(p *WorkflowPayload) { p.States[1].Initial = true }, errInitialState},
+		{"no terminal state", func(p *WorkflowPayload) { p.States[2].Terminal = false }, errTerminalState},
+		{"unknown state", func(p *WorkflowPayload) { p.Transitions[0].To = "DONE" }, errInvalidTransition},
+		{"duplicate transition", func(p *WorkflowPayload) { p.Transitions[1] = p.Transitions[0] }, errInvalidTransition},
+		{"reopen transition", func(p *WorkflowPayload) {
+			p.Transitions = append(p.Transitions, &WorkflowTransition{From: "CLOSED", To: "OPEN"})
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.modify(p)
+
+			err := validateWorkflowPayload(p)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected error %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestWorkflowTransitions(t *testing.T) {
+	workflow := &Workflow{
+		States: []*WorkflowState{
+			{Name: "OPEN", Initial: true},
+			{Name: "IN_REVIEW"},
+			{Name: "CLOSED", Terminal: true},
+		},
+		Transitions: []*WorkflowTransition{
+			{From: "OPEN", To: "IN_REVIEW"},
+			{From: "IN_REVIEW", To: "CLOSED"},
+			{From: "IN_REVIEW", To: "OPEN"},
+		},
+	}
+
+	if err := workflow.checkTransition("OPEN", "IN_REVIEW"); err != nil {
+		t.Errorf("expected OPEN to IN_REVIEW to be allowed, got %v", err)
+	}
+
+	if err := workflow.checkTransition("OPEN", "OPEN"); err != nil {
+		t.Errorf("expected staying in OPEN to be allowed, got %v", err)
+	}
+
+	err := workflow.checkTransition("OPEN", "CLOSED")
+	if !errors.Is(err, errTransitionNotAllowed) {
+		t.Fatalf("expected %v, got %v", errTransitionNotAllowed, err)
+	}
+	if err.Error() != "transition not allowed: OPEN to CLOSED, OPEN can move to IN_REVIEW" {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	if err := workflow.checkTransition("CLOSED", "OPEN"); !errors.Is(err, errTransitionNotAllowed) {
+		t.Errorf("expected %v, got %v", errTransitionNotAllowed, err)
+	}
+
+	// terminal only means closed, a workflow may still reopen
+	if !DefaultWorkflow(1).CanTransition(StatusDone, StatusTODO) {
+		t.Error("expected done tasks to be reopened")
+	}
+
+	if err := workflow.checkTransition("OPEN", "DONE"); !errors.Is(err, invalidStatus) {
+		t.Errorf("expected %v, got %v", invalidStatus, err)
+	}
+
+	if workflow.InitialState() != "OPEN" {
+		t.Errorf("expected initial state OPEN, got %s", workflow.InitialState())
+	}
+}
+
+func TestUpdateWorkflow(t *testing.T) {
+	ms := &MockStore{}
+	service := NewProjectService(ms)
+
+	put := func(payload *WorkflowPayload) *httptest.ResponseRecorder {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, err := http.NewRequest(http.MethodPut, "/projects/1/workflow", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+
+		router.HandleFunc("/projects/{id}/workflow", service.handleUpdateWorkflow)
+		router.ServeHTTP(rr, withUserID(req, 1))
+
+		return rr
+	}
+
+	t.Run("should return error if the workflow has no initial state", func(t *testing.T) {
+		rr := put(&WorkflowPayload{States: []*WorkflowState{{Name: "DONE", Terminal: true}}})
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should save the workflow", func(t *testing.T) {
+		rr := put(&WorkflowPayload{
+			States:      []*WorkflowState{{Name: "OPEN", Initial: true}, {Name: "CLOSED", Terminal: true}},
+			Transitions: []*WorkflowTransition{{From: "OPEN", To: "CLOSED"}},
+		})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var workflow Workflow
+		if err := json.NewDecoder(rr.Body).Decode(&workflow); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(workflow.States) != 2 || workflow.InitialState() != "OPEN" {
+			t.Errorf("unexpected workflow %+v", workflow)
+		}
+	})
+}